@@ -0,0 +1,136 @@
+package fdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// AccessLogConfig configures the access log, a log line the runner writes for every
+// request with its route, method, status, duration, sizes, errors, trace ID, and the
+// workflow execution ID when present. Failed requests, those answered with a status of
+// 400 or above, are always logged.
+type AccessLogConfig struct {
+	// SuccessSampleRate is the fraction of successful requests logged, greater than 0 and
+	// up to 1. Set via CS_ACCESS_LOG_SAMPLE_RATE. Defaults to 1, logging every request.
+	SuccessSampleRate float64
+	// FailuresOnly logs failed requests only. Set via CS_ACCESS_LOG_FAILURES_ONLY=true.
+	FailuresOnly bool
+}
+
+// WithAccessLog enables the access log. The access log may also be enabled via the
+// CS_ACCESS_LOG=true env var. Fields set on the provided config take precedence over
+// their env vars.
+func WithAccessLog(cfg AccessLogConfig) RunOpt {
+	return func(o *runOpts) {
+		o.accessLog = &cfg
+	}
+}
+
+// accessLogCfg returns the access log config, or nil when the access log is disabled.
+func accessLogCfg(cfg *AccessLogConfig) (*AccessLogConfig, error) {
+	if cfg == nil {
+		v := os.Getenv("CS_ACCESS_LOG")
+		if v == "" {
+			return nil, nil
+		}
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CS_ACCESS_LOG provided: %q", v)
+		}
+		if !enabled {
+			return nil, nil
+		}
+		cfg = new(AccessLogConfig)
+	}
+	out := *cfg
+
+	if v := os.Getenv("CS_ACCESS_LOG_SAMPLE_RATE"); out.SuccessSampleRate == 0 && v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CS_ACCESS_LOG_SAMPLE_RATE provided: %q", v)
+		}
+		out.SuccessSampleRate = rate
+	}
+	if out.SuccessSampleRate == 0 {
+		out.SuccessSampleRate = 1
+	}
+	if out.SuccessSampleRate < 0 || out.SuccessSampleRate > 1 {
+		return nil, fmt.Errorf("invalid access log success sample rate provided, must be greater than 0 and up to 1: %v", out.SuccessSampleRate)
+	}
+
+	if v := os.Getenv("CS_ACCESS_LOG_FAILURES_ONLY"); !out.FailuresOnly && v != "" {
+		failuresOnly, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CS_ACCESS_LOG_FAILURES_ONLY provided: %q", v)
+		}
+		out.FailuresOnly = failuresOnly
+	}
+
+	return &out, nil
+}
+
+// log writes the access log line of the invocation. Server errors are logged at the
+// error level, client errors at the warn level, and the rest at the info level.
+func (cfg *AccessLogConfig) log(logger *slog.Logger, r Request, inv invocation) {
+	if cfg == nil {
+		return
+	}
+
+	status := inv.resp.StatusCode()
+	failed := status >= http.StatusBadRequest
+	if !failed && (cfg.FailuresOnly || rand.Float64() >= cfg.SuccessSampleRate) {
+		return
+	}
+
+	level := slog.LevelInfo
+	switch {
+	case status >= http.StatusInternalServerError:
+		level = slog.LevelError
+	case failed:
+		level = slog.LevelWarn
+	}
+
+	attrs := []slog.Attr{
+		slog.String("route", inv.route),
+		slog.String("method", inv.method),
+		slog.Int("status", status),
+		slog.Float64("duration_ms", float64(inv.duration.Microseconds())/1000),
+		slog.Int("request_bytes", inv.reqBytes),
+		slog.Int("response_bytes", inv.respBytes),
+		slog.Int("error_count", len(inv.resp.Errors)),
+	}
+	if len(inv.resp.Errors) > 0 {
+		msgs := make([]string, 0, len(inv.resp.Errors))
+		for _, e := range inv.resp.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		attrs = append(attrs, slog.Any("errors", msgs))
+	}
+	attrs = append(attrs, slog.String("trace_id", r.TraceID))
+	if execID := workflowExecutionID(r); execID != "" {
+		attrs = append(attrs, slog.String("workflow_execution_id", execID))
+	}
+
+	logger.LogAttrs(context.Background(), level, "request handled", attrs...)
+}
+
+// workflowExecutionID returns the execution ID of the workflow context of the request,
+// or an empty string when the request does not carry one.
+func workflowExecutionID(r Request) string {
+	if len(r.Context) == 0 {
+		return ""
+	}
+	var w struct {
+		ExecutionID string `json:"execution_id"`
+	}
+	if err := json.Unmarshal(r.Context, &w); err != nil {
+		return ""
+	}
+	return w.ExecutionID
+}
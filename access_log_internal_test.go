@@ -0,0 +1,188 @@
+package fdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	type accessLine struct {
+		Level               string   `json:"level"`
+		Msg                 string   `json:"msg"`
+		Route               string   `json:"route"`
+		Method              string   `json:"method"`
+		Status              int      `json:"status"`
+		DurationMS          *float64 `json:"duration_ms"`
+		RequestBytes        int      `json:"request_bytes"`
+		ResponseBytes       int      `json:"response_bytes"`
+		ErrorCount          int      `json:"error_count"`
+		Errors              []string `json:"errors"`
+		TraceID             string   `json:"trace_id"`
+		WorkflowExecutionID string   `json:"workflow_execution_id"`
+	}
+
+	mux := NewMux()
+	mux.Get("/people/{id}", HandlerFn(func(ctx context.Context, r Request) Response {
+		return Response{Code: http.StatusOK, Body: JSON(map[string]string{"name": "frodo"})}
+	}))
+	mux.Post("/people", HandlerFn(func(ctx context.Context, r Request) Response {
+		return ErrResp(APIError{Code: http.StatusBadRequest, Message: "name is required"})
+	}))
+
+	tests := []struct {
+		name     string
+		cfg      AccessLogConfig
+		envelope string
+		want     []accessLine
+	}{
+		{
+			name:     "successful request should be logged",
+			envelope: `{"method":"GET","url":"/people/frodo","trace_id":"trace1","context":{"execution_id":"exec1"}}`,
+			want: []accessLine{{
+				Level:               "INFO",
+				Msg:                 "request handled",
+				Route:               "/people/{id}",
+				Method:              http.MethodGet,
+				Status:              http.StatusOK,
+				ErrorCount:          0,
+				TraceID:             "trace1",
+				WorkflowExecutionID: "exec1",
+			}},
+		},
+		{
+			name:     "failed request should be logged with its errors",
+			cfg:      AccessLogConfig{FailuresOnly: true},
+			envelope: `{"method":"POST","url":"/people","trace_id":"trace2"}`,
+			want: []accessLine{{
+				Level:      "WARN",
+				Msg:        "request handled",
+				Route:      "/people",
+				Method:     http.MethodPost,
+				Status:     http.StatusBadRequest,
+				ErrorCount: 1,
+				Errors:     []string{"name is required"},
+				TraceID:    "trace2",
+			}},
+		},
+		{
+			name:     "unmatched route should be logged without a route",
+			envelope: `{"method":"GET","url":"/monsters","trace_id":"trace3"}`,
+			want: []accessLine{{
+				Level:      "WARN",
+				Msg:        "request handled",
+				Method:     http.MethodGet,
+				Status:     http.StatusNotFound,
+				ErrorCount: 1,
+				Errors:     []string{"route not found"},
+				TraceID:    "trace3",
+			}},
+		},
+		{
+			name:     "invalid request envelope should be logged",
+			envelope: `{"method":`,
+			want: []accessLine{{
+				Level:      "WARN",
+				Msg:        "request handled",
+				Status:     http.StatusBadRequest,
+				ErrorCount: 1,
+				Errors:     []string{"request body is not a valid JSON request envelope"},
+			}},
+		},
+		{
+			name:     "successful request should not be logged with failures only",
+			cfg:      AccessLogConfig{FailuresOnly: true},
+			envelope: `{"method":"GET","url":"/people/frodo"}`,
+		},
+		{
+			name:     "successful request should not be logged when not sampled",
+			cfg:      AccessLogConfig{SuccessSampleRate: 1e-12},
+			envelope: `{"method":"GET","url":"/people/frodo"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := accessLogCfg(&tt.cfg)
+			mustNoErrInternal(t, err)
+
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&logs, nil))
+			ctx := withRunOpts(context.Background(), runOpts{accessLog: cfg})
+
+			resp, err := dispatchEnvelope(ctx, logger, dispatchReq(logger, mux), []byte(tt.envelope))
+			mustNoErrInternal(t, err)
+
+			var got []accessLine
+			for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+				if line == "" {
+					continue
+				}
+				var l accessLine
+				mustNoErrInternal(t, json.Unmarshal([]byte(line), &l))
+				if l.Msg == "request handled" {
+					got = append(got, l)
+				}
+			}
+
+			if !EqualVals(t, len(tt.want), len(got)) {
+				return
+			}
+			for i, want := range tt.want {
+				g := got[i]
+				EqualVals(t, want.Level, g.Level)
+				EqualVals(t, want.Route, g.Route)
+				EqualVals(t, want.Method, g.Method)
+				EqualVals(t, want.Status, g.Status)
+				EqualVals(t, want.ErrorCount, g.ErrorCount)
+				EqualVals(t, strings.Join(want.Errors, ","), strings.Join(g.Errors, ","))
+				EqualVals(t, want.TraceID, g.TraceID)
+				EqualVals(t, want.WorkflowExecutionID, g.WorkflowExecutionID)
+				EqualVals(t, true, g.DurationMS != nil)
+				EqualVals(t, len(tt.envelope), g.RequestBytes)
+				EqualVals(t, len(resp), g.ResponseBytes)
+			}
+		})
+	}
+}
+
+func TestAccessLogCfg(t *testing.T) {
+	t.Run("without the env var or option should be disabled", func(t *testing.T) {
+		cfg, err := accessLogCfg(nil)
+		mustNoErrInternal(t, err)
+		EqualVals(t, true, cfg == nil)
+	})
+
+	t.Run("env vars should enable and configure the access log", func(t *testing.T) {
+		t.Setenv("CS_ACCESS_LOG", "true")
+		t.Setenv("CS_ACCESS_LOG_SAMPLE_RATE", "0.25")
+		t.Setenv("CS_ACCESS_LOG_FAILURES_ONLY", "true")
+
+		cfg, err := accessLogCfg(nil)
+		mustNoErrInternal(t, err)
+		EqualVals(t, AccessLogConfig{SuccessSampleRate: 0.25, FailuresOnly: true}, *cfg)
+	})
+
+	t.Run("option should take precedence over the env vars", func(t *testing.T) {
+		t.Setenv("CS_ACCESS_LOG", "false")
+		t.Setenv("CS_ACCESS_LOG_SAMPLE_RATE", "0.25")
+
+		cfg, err := accessLogCfg(&AccessLogConfig{SuccessSampleRate: 0.5})
+		mustNoErrInternal(t, err)
+		EqualVals(t, AccessLogConfig{SuccessSampleRate: 0.5}, *cfg)
+	})
+
+	t.Run("invalid sample rate should fail", func(t *testing.T) {
+		t.Setenv("CS_ACCESS_LOG_SAMPLE_RATE", "1.5")
+
+		_, err := accessLogCfg(&AccessLogConfig{})
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		EqualVals(t, "invalid access log success sample rate provided, must be greater than 0 and up to 1: 1.5", err.Error())
+	})
+}
@@ -0,0 +1,447 @@
+package fdk
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+// errBodyNotJSON is returned for a request body the replay runner could not re-send,
+// i.e. the file of a multipart request.
+var errBodyNotJSON = errors.New("request body is not JSON")
+
+// captureCfg configures the traffic capture. The capture is configured via env vars:
+//
+//	CS_CAPTURE_FILE               the JSONL file captures are written to, setting it enables the capture
+//	CS_CAPTURE_MAX_BYTES          size at which the capture file is rotated, defaults to 10MB
+//	CS_CAPTURE_MAX_BACKUPS        number of rotated capture files to keep, defaults to 3
+//	CS_CAPTURE_REDACT_HEADERS     comma separated headers to redact, in addition to Authorization, Cookie and Set-Cookie
+//	CS_CAPTURE_REDACT_FIELDS      comma separated JSON pointers, i.e. /user/password, to redact from request and response bodies
+//	CS_CAPTURE_KEEP_ACCESS_TOKEN  when true, the access token is not redacted
+type captureCfg struct {
+	file            string
+	maxBytes        int64
+	maxBackups      int
+	redactHeaders   []string
+	redactFields    [][]string
+	keepAccessToken bool
+}
+
+func captureCfgFromEnv() (captureCfg, error) {
+	cfg := captureCfg{
+		file:          os.Getenv("CS_CAPTURE_FILE"),
+		maxBytes:      10 * mb,
+		maxBackups:    3,
+		redactHeaders: []string{"Authorization", "Cookie", "Set-Cookie"},
+	}
+
+	if v := os.Getenv("CS_CAPTURE_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return captureCfg{}, fmt.Errorf("invalid CS_CAPTURE_MAX_BYTES provided: %q", v)
+		}
+		cfg.maxBytes = n
+	}
+	if v := os.Getenv("CS_CAPTURE_MAX_BACKUPS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return captureCfg{}, fmt.Errorf("invalid CS_CAPTURE_MAX_BACKUPS provided: %q", v)
+		}
+		cfg.maxBackups = n
+	}
+	cfg.redactHeaders = append(cfg.redactHeaders, splitCSV(os.Getenv("CS_CAPTURE_REDACT_HEADERS"))...)
+	for _, ptr := range splitCSV(os.Getenv("CS_CAPTURE_REDACT_FIELDS")) {
+		tokens, err := parseJSONPointer(ptr)
+		if err != nil {
+			return captureCfg{}, fmt.Errorf("invalid CS_CAPTURE_REDACT_FIELDS provided: %w", err)
+		}
+		cfg.redactFields = append(cfg.redactFields, tokens)
+	}
+	if v := os.Getenv("CS_CAPTURE_KEEP_ACCESS_TOKEN"); v != "" {
+		keep, err := strconv.ParseBool(v)
+		if err != nil {
+			return captureCfg{}, fmt.Errorf("invalid CS_CAPTURE_KEEP_ACCESS_TOKEN provided: %q", v)
+		}
+		cfg.keepAccessToken = keep
+	}
+
+	return cfg, nil
+}
+
+// captureMiddleware returns the traffic capture middleware as configured by the env. When
+// the capture is not enabled, the handler is left as is. An invalid capture config
+// panics, so that the runner fails to start.
+func captureMiddleware(logger *slog.Logger) Middleware {
+	noop := func(h Handler) Handler { return h }
+
+	cfg, err := captureCfgFromEnv()
+	if err != nil {
+		panic(err.Error())
+	}
+	if cfg.file == "" {
+		return noop
+	}
+
+	w, err := newRotatingFile(cfg.file, cfg.maxBytes, cfg.maxBackups)
+	if err != nil {
+		panic(fmt.Sprintf("failed to open CS_CAPTURE_FILE: %s", err))
+	}
+	logger.Info("capturing traffic to " + cfg.file)
+
+	c := &capturer{cfg: cfg, logger: logger, w: w}
+	return c.middleware
+}
+
+// capturer writes each request envelope and its response to the capture file. Records
+// are written in the replay runner's corpus format, with the response as the golden
+// response. Replay matches a redacted golden value against any value. Requests to the
+// health routes, and requests whose body is not JSON, are not captured.
+type capturer struct {
+	cfg    captureCfg
+	logger *slog.Logger
+	w      io.Writer
+}
+
+func (c *capturer) middleware(next Handler) Handler {
+	return HandlerFn(func(ctx context.Context, r Request) Response {
+		if isHealthReq(r) {
+			return next.Handle(ctx, r)
+		}
+
+		reqEnvelope, err := c.requestEnvelope(&r)
+		if errors.Is(err, errBodyNotJSON) {
+			c.logger.Debug("request not captured, its body is not JSON and can't be replayed", "method", r.Method, "url", r.URL)
+			return next.Handle(ctx, r)
+		}
+		if err != nil {
+			c.logger.Error("failed to capture request", "err", err)
+			return next.Handle(ctx, r)
+		}
+
+		resp := next.Handle(ctx, r)
+
+		f, ok := resp.Body.(File)
+		if !ok || f.Contents == nil {
+			c.record(reqEnvelope, resp)
+			return resp
+		}
+
+		// the checksum and size of the file are only known once the runner has
+		// written the contents, so the record is written when the contents are closed.
+		f = NormalizeFile(f)
+		fileResp := resp
+		f.Contents = &captureFileContents{
+			ReadCloser: f.Contents,
+			h:          sha256.New(),
+			onClose: func(sha256Hash string, size int, err error) {
+				if err != nil {
+					c.logger.Error("failed to capture file response", "err", err)
+					return
+				}
+				fileResp.Body = JSON(fileRespBody{
+					ContentType: f.ContentType,
+					Encoding:    f.Encoding,
+					Filename:    f.Filename,
+					SHA256:      sha256Hash,
+					Size:        size,
+				})
+				c.record(reqEnvelope, fileResp)
+			},
+		}
+		resp.Body = f
+		return resp
+	})
+}
+
+// requestEnvelope builds the redacted request envelope. The request body is read and
+// replaced, so the handler is unaffected by the capture.
+func (c *capturer) requestEnvelope(r *Request) (json.RawMessage, error) {
+	var body []byte
+	switch b := r.Body.(type) {
+	case nil:
+	case *ComplexPayload:
+		// the files of a complex payload are not captured
+		body = b.Body
+	default:
+		var err error
+		body, err = io.ReadAll(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		r.Body = bytes.NewReader(body)
+	}
+	if body = bytes.TrimSpace(body); len(body) > 0 && !json.Valid(body) {
+		return nil, errBodyNotJSON
+	}
+
+	body, err := c.redactBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken := r.AccessToken
+	if !c.cfg.keepAccessToken && accessToken != "" {
+		accessToken = redacted
+	}
+
+	// the deadline of a captured request has long passed by the time it is replayed
+	headers := c.redactHeaders(r.Headers)
+	delete(headers, headerDeadline)
+
+	return json.Marshal(struct {
+		reqMeta
+		Body json.RawMessage `json:"body,omitempty"`
+	}{
+		reqMeta: reqMeta{
+			FnID:        r.FnID,
+			FnVersion:   r.FnVersion,
+			Context:     r.Context,
+			AccessToken: accessToken,
+			Method:      r.Method,
+			Headers:     headers,
+			Queries:     r.Queries,
+			URL:         r.URL,
+			TraceID:     r.TraceID,
+		},
+		Body: body,
+	})
+}
+
+func (c *capturer) record(reqEnvelope json.RawMessage, resp Response) {
+	err := func() error {
+		env := newRespEnvelope(resp)
+		env.Headers = c.redactHeaders(env.Headers)
+		if env.Body != nil {
+			b, err := env.Body.MarshalJSON()
+			if err != nil {
+				return fmt.Errorf("failed to marshal response body: %w", err)
+			}
+			b, err = c.redactBody(b)
+			if err != nil {
+				return err
+			}
+			env.Body = json.RawMessage(b)
+		}
+
+		respEnvelope, err := json.Marshal(env)
+		if err != nil {
+			return fmt.Errorf("failed to marshal response: %w", err)
+		}
+
+		line, err := json.Marshal(replayRecord{Request: reqEnvelope, Response: respEnvelope})
+		if err != nil {
+			return fmt.Errorf("failed to marshal capture record: %w", err)
+		}
+
+		_, err = c.w.Write(append(line, '\n'))
+		return err
+	}()
+	if err != nil {
+		c.logger.Error("failed to write capture record", "err", err)
+	}
+}
+
+func (c *capturer) redactHeaders(h http.Header) http.Header {
+	if len(h) == 0 {
+		return h
+	}
+
+	out := make(http.Header, len(h))
+	for k, v := range h {
+		out[k] = v
+		for _, name := range c.cfg.redactHeaders {
+			if strings.EqualFold(k, name) {
+				out[k] = []string{redacted}
+				break
+			}
+		}
+	}
+	return out
+}
+
+// redactBody redacts the configured fields from a JSON body.
+func (c *capturer) redactBody(body []byte) ([]byte, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, nil
+	}
+	if len(c.cfg.redactFields) == 0 {
+		return body, nil
+	}
+
+	v, err := decodeJSONNumbers(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode body for redaction: %w", err)
+	}
+	for _, tokens := range c.cfg.redactFields {
+		v = redactJSON(v, tokens)
+	}
+	return json.Marshal(v)
+}
+
+// redactJSON replaces the value at the path of tokens with the redacted marker. The "*"
+// token matches every key of an object or element of an array.
+func redactJSON(v any, tokens []string) any {
+	if len(tokens) == 0 {
+		return redacted
+	}
+
+	tok, rest := tokens[0], tokens[1:]
+	switch vv := v.(type) {
+	case map[string]any:
+		for k, child := range vv {
+			if tok == "*" || tok == k {
+				vv[k] = redactJSON(child, rest)
+			}
+		}
+	case []any:
+		for i, child := range vv {
+			if tok == "*" || tok == strconv.Itoa(i) {
+				vv[i] = redactJSON(child, rest)
+			}
+		}
+	}
+	return v
+}
+
+func parseJSONPointer(ptr string) ([]string, error) {
+	if ptr == "" || !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("JSON pointer must start with a /: %q", ptr)
+	}
+
+	tokens := strings.Split(ptr[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+func splitCSV(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// captureFileContents computes the checksum and size of file contents as the runner
+// reads them.
+type captureFileContents struct {
+	io.ReadCloser
+	h       hash.Hash
+	size    int
+	err     error
+	once    sync.Once
+	onClose func(sha256Hash string, size int, err error)
+}
+
+func (c *captureFileContents) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.h.Write(p[:n])
+	c.size += n
+	if err != nil && err != io.EOF {
+		c.err = err
+	}
+	return n, err
+}
+
+func (c *captureFileContents) Close() error {
+	err := c.ReadCloser.Close()
+	c.once.Do(func() {
+		c.onClose(base64.StdEncoding.EncodeToString(c.h.Sum(nil)), c.size, c.err)
+	})
+	return err
+}
+
+// rotatingFile is an append only file that is rotated once it reaches maxBytes. Rotated
+// files are suffixed with .1, .2, and so on, with .1 being the most recent.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	f    *os.File
+	size int64
+}
+
+func newRotatingFile(path string, maxBytes int64, maxBackups int) (*rotatingFile, error) {
+	w := &rotatingFile{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotatingFile) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.size > 0 && w.size+int64(len(p)) > w.maxBytes {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingFile) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open capture file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stat capture file: %w", err)
+	}
+	w.f, w.size = f, fi.Size()
+	return nil
+}
+
+func (w *rotatingFile) rotate() error {
+	if err := w.f.Close(); err != nil {
+		return fmt.Errorf("failed to close capture file: %w", err)
+	}
+
+	backup := func(i int) string { return w.path + "." + strconv.Itoa(i) }
+	if w.maxBackups == 0 {
+		if err := os.Remove(w.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove capture file: %w", err)
+		}
+	} else {
+		for i := w.maxBackups - 1; i >= 1; i-- {
+			if err := os.Rename(backup(i), backup(i+1)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to rotate capture file: %w", err)
+			}
+		}
+		if err := os.Rename(w.path, backup(1)); err != nil {
+			return fmt.Errorf("failed to rotate capture file: %w", err)
+		}
+	}
+
+	return w.open()
+}
@@ -0,0 +1,135 @@
+package fdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCapture(t *testing.T) {
+	outFile := filepath.Join(t.TempDir(), "out.txt")
+	mux := NewMux()
+	mux.Post("/login", HandleFnOf(func(ctx context.Context, r RequestOf[struct {
+		User     string `json:"user"`
+		Password string `json:"password"`
+	}]) Response {
+		return Response{
+			Code:   http.StatusOK,
+			Body:   JSON(map[string]string{"user": r.Body.User, "session": "s3cr3t"}),
+			Header: http.Header{"Set-Cookie": []string{"session=s3cr3t"}},
+		}
+	}))
+	mux.Get("/file", HandlerFn(func(ctx context.Context, r Request) Response {
+		return Response{Body: File{
+			ContentType: "text/plain",
+			Filename:    outFile,
+			Contents:    io.NopCloser(strings.NewReader("some contents")),
+		}}
+	}))
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	captureFile := filepath.Join(t.TempDir(), "captures", "capture.jsonl")
+	t.Setenv("CS_CAPTURE_FILE", captureFile)
+	t.Setenv("CS_CAPTURE_REDACT_HEADERS", "X-Api-Key")
+	t.Setenv("CS_CAPTURE_REDACT_FIELDS", "/password,/session")
+
+	captured := captureMiddleware(logger)(mux)
+	dispatch := dispatchReq(logger, captured)
+	for _, envelope := range []string{
+		`{"method":"POST","url":"/login","access_token":"tok","header":{"X-Api-Key":["key"],"X-Other":["other"]},"body":{"user":"frodo","password":"ring"}}`,
+		`{"method":"GET","url":"/file"}`,
+		`{"method":"GET","url":"/healthz"}`,
+	} {
+		_, err := dispatchEnvelope(context.Background(), logger, dispatch, []byte(envelope))
+		mustNoErrInternal(t, err)
+	}
+	// the body file of a multipart request is handed to the handler as is
+	captured.Handle(context.Background(), Request{Method: http.MethodPost, URL: "/upload", Body: strings.NewReader("not json")})
+
+	b, err := os.ReadFile(captureFile)
+	mustNoErrInternal(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	EqualVals(t, 2, len(lines))
+
+	t.Run("should redact the access token, headers and body fields", func(t *testing.T) {
+		var rec struct {
+			Request struct {
+				AccessToken string              `json:"access_token"`
+				Headers     map[string][]string `json:"header"`
+				Body        map[string]string   `json:"body"`
+			} `json:"request"`
+			Response struct {
+				Body    map[string]string   `json:"body"`
+				Headers map[string][]string `json:"headers"`
+			} `json:"response"`
+		}
+		mustNoErrInternal(t, json.Unmarshal([]byte(lines[0]), &rec))
+
+		EqualVals(t, redacted, rec.Request.AccessToken)
+		EqualVals(t, redacted, rec.Request.Headers["X-Api-Key"][0])
+		EqualVals(t, "other", rec.Request.Headers["X-Other"][0])
+		EqualVals(t, "frodo", rec.Request.Body["user"])
+		EqualVals(t, redacted, rec.Request.Body["password"])
+		EqualVals(t, redacted, rec.Response.Body["session"])
+		EqualVals(t, redacted, rec.Response.Headers["Set-Cookie"][0])
+	})
+
+	t.Run("should record the file checksum and size written by the runner", func(t *testing.T) {
+		var rec struct {
+			Response struct {
+				Body fileRespBody `json:"body"`
+			} `json:"response"`
+		}
+		mustNoErrInternal(t, json.Unmarshal([]byte(lines[1]), &rec))
+
+		EqualVals(t, outFile, rec.Response.Body.Filename)
+		EqualVals(t, "some contents", readTestFile(t, outFile))
+		EqualVals(t, len("some contents"), rec.Response.Body.Size)
+		if rec.Response.Body.SHA256 == "" {
+			t.Error("expected a sha256 checksum")
+		}
+	})
+
+	t.Run("captures should replay with the redacted response values matching any value", func(t *testing.T) {
+		var out bytes.Buffer
+		summary, err := replayCorpus(context.Background(), logger, mux, replayCfg{corpus: captureFile}, &out)
+		mustNoErrInternal(t, err)
+
+		EqualVals(t, 2, summary.passed)
+		EqualVals(t, 0, summary.failed)
+	})
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	w, err := newRotatingFile(path, 10, 2)
+	mustNoErrInternal(t, err)
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := w.Write([]byte(line))
+		mustNoErrInternal(t, err)
+	}
+
+	EqualVals(t, "fourth\n", readTestFile(t, path))
+	EqualVals(t, "third\n", readTestFile(t, path+".1"))
+	EqualVals(t, "second\n", readTestFile(t, path+".2"))
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups, got err: %v", err)
+	}
+}
+
+func readTestFile(t *testing.T, filename string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(filename)
+	mustNoErrInternal(t, err)
+	return string(b)
+}
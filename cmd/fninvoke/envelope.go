@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// envelope is the request payload the function runner expects. When files are provided,
+// it is sent as the meta field of a multipart form.
+type envelope struct {
+	AccessToken string          `json:"access_token,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	Context     json.RawMessage `json:"context,omitempty"`
+	FnID        string          `json:"fn_id,omitempty"`
+	FnVersion   int             `json:"fn_version,omitempty"`
+	Method      string          `json:"method"`
+	Header      http.Header     `json:"header,omitempty"`
+	Query       url.Values      `json:"query,omitempty"`
+	URL         string          `json:"url"`
+	TraceID     string          `json:"trace_id,omitempty"`
+}
+
+// newEnvelopeReq creates the http request carrying the envelope to the function. Without
+// files, the envelope is sent as JSON. With a single file and no body, the file is sent as
+// the body form file. Otherwise, each file is sent as its own form file and the body as a
+// form value, matching the runner's complex multipart handling.
+func newEnvelopeReq(addr string, env envelope, files []string) (*http.Request, error) {
+	if len(files) == 0 {
+		b, err := json.Marshal(env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal envelope: %w", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, addr, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}
+
+	body := env.Body
+	env.Body = nil
+
+	meta, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if err := mw.WriteField("meta", string(meta)); err != nil {
+		return nil, fmt.Errorf("failed to write meta field: %w", err)
+	}
+
+	simple := len(files) == 1 && len(body) == 0
+	if !simple && len(body) > 0 {
+		if err := mw.WriteField("body", string(body)); err != nil {
+			return nil, fmt.Errorf("failed to write body field: %w", err)
+		}
+	}
+
+	for _, file := range files {
+		field := filepath.Base(file)
+		if simple {
+			field = "body"
+		}
+		if err := writeFormFile(mw, field, file); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, addr, &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req, nil
+}
+
+func writeFormFile(mw *multipart.Writer, field, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	w, err := mw.CreateFormFile(field, filepath.Base(filename))
+	if err != nil {
+		return fmt.Errorf("failed to create form file %s: %w", filename, err)
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("failed to write form file %s: %w", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+// Command fninvoke invokes a function with the request envelope the function runner
+// expects. It builds the JSON envelope, or the multipart envelope when files are
+// provided, posts it to a running function, and pretty prints the response. The
+// function binary may instead be started locally for the duration of the invocation.
+//
+// Usage:
+//
+//	fninvoke [flags]
+//
+// Examples:
+//
+//	fninvoke -X POST -path /echo -d '{"name":"frodo"}'
+//	fninvoke -X POST -path /upload -F ./lorem-ipsum.txt
+//	fninvoke -exec ./run_me -X GET -path /people -q name=frodo -H 'X-Cs-Origin: local'
+//	fninvoke -X POST -path /file -d @req.json -out ./downloads
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("fninvoke", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var (
+		addr        = fs.String("addr", defaultAddr(), "address of the running function")
+		execPath    = fs.String("exec", "", "function binary to start locally for the invocation, instead of using -addr")
+		method      = fs.String("X", http.MethodGet, "HTTP method of the request")
+		path        = fs.String("path", "/", "path of the request")
+		body        = fs.String("d", "", "JSON request body, or @filename to read it from a file")
+		wrkCtx      = fs.String("context", "", "JSON request context, i.e. a workflow context, or @filename")
+		fnID        = fs.String("fn-id", "", "function ID")
+		fnVersion   = fs.Int("fn-version", 0, "function version")
+		traceID     = fs.String("trace-id", "", "trace ID")
+		accessToken = fs.String("access-token", "", "access token")
+		outDir      = fs.String("out", "", "directory to copy File responses into")
+		timeout     = fs.Duration("timeout", 30*time.Second, "timeout of the invocation")
+
+		headers multiFlag
+		queries multiFlag
+		files   multiFlag
+	)
+	fs.Var(&headers, "H", "request header as 'Key: value', may be repeated")
+	fs.Var(&queries, "q", "query parameter as key=value, may be repeated")
+	fs.Var(&files, "F", "file to send in a multipart request, may be repeated")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	env := envelope{
+		AccessToken: *accessToken,
+		FnID:        *fnID,
+		FnVersion:   *fnVersion,
+		Method:      strings.ToUpper(*method),
+		URL:         *path,
+		TraceID:     *traceID,
+	}
+
+	var err error
+	if env.Body, err = readJSONArg(*body); err != nil {
+		return fail(stderr, fmt.Errorf("invalid body: %w", err))
+	}
+	if env.Context, err = readJSONArg(*wrkCtx); err != nil {
+		return fail(stderr, fmt.Errorf("invalid context: %w", err))
+	}
+	if env.Header, err = parseHeaders(headers); err != nil {
+		return fail(stderr, err)
+	}
+	if env.Query, err = parseQueries(queries); err != nil {
+		return fail(stderr, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	if *execPath != "" {
+		target, stop, err := startFn(ctx, *execPath, stderr)
+		if err != nil {
+			return fail(stderr, err)
+		}
+		defer stop()
+		*addr = target
+	}
+
+	req, err := newEnvelopeReq(*addr, env, files)
+	if err != nil {
+		return fail(stderr, err)
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fail(stderr, fmt.Errorf("failed to invoke function: %w", err))
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fail(stderr, fmt.Errorf("failed to read response: %w", err))
+	}
+
+	fmt.Fprintf(stdout, "HTTP %s\n", resp.Status)
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, b, "", "  "); err != nil {
+		pretty.Reset()
+		pretty.Write(b)
+	}
+	fmt.Fprintln(stdout, pretty.String())
+
+	if *outDir != "" {
+		if err := copyFileResp(b, *outDir, stderr); err != nil {
+			return fail(stderr, err)
+		}
+	}
+
+	if resp.StatusCode >= 400 {
+		return 1
+	}
+	return 0
+}
+
+func defaultAddr() string {
+	port := 8081
+	if v, _ := strconv.Atoi(os.Getenv("PORT")); v > 0 {
+		port = v
+	}
+	return "http://localhost:" + strconv.Itoa(port)
+}
+
+func fail(stderr io.Writer, err error) int {
+	fmt.Fprintln(stderr, "fninvoke: "+err.Error())
+	return 1
+}
+
+type multiFlag []string
+
+func (m *multiFlag) String() string {
+	return strings.Join(*m, ", ")
+}
+
+func (m *multiFlag) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+func readJSONArg(v string) (json.RawMessage, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	b := []byte(v)
+	if filename, ok := strings.CutPrefix(v, "@"); ok {
+		var err error
+		b, err = os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+
+	if !json.Valid(b) {
+		return nil, errors.New("not valid json")
+	}
+	return b, nil
+}
+
+func parseHeaders(vals []string) (http.Header, error) {
+	if len(vals) == 0 {
+		return nil, nil
+	}
+
+	h := make(http.Header)
+	for _, v := range vals {
+		k, val, ok := strings.Cut(v, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q, must be 'Key: value'", v)
+		}
+		h.Add(strings.TrimSpace(k), strings.TrimSpace(val))
+	}
+	return h, nil
+}
+
+func parseQueries(vals []string) (url.Values, error) {
+	if len(vals) == 0 {
+		return nil, nil
+	}
+
+	q := make(url.Values)
+	for _, v := range vals {
+		k, val, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid query parameter %q, must be key=value", v)
+		}
+		q.Add(k, val)
+	}
+	return q, nil
+}
+
+// startFn starts the function binary on a free port and waits for it to accept
+// connections. The returned stop func interrupts the function and waits for it to exit.
+func startFn(ctx context.Context, path string, stderr io.Writer) (string, func(), error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	if err := l.Close(); err != nil {
+		return "", nil, fmt.Errorf("failed to release port: %w", err)
+	}
+
+	cmd := exec.Command(path)
+	cmd.Env = append(os.Environ(), "PORT="+port)
+	cmd.Stdout, cmd.Stderr = stderr, stderr
+	if err := cmd.Start(); err != nil {
+		return "", nil, fmt.Errorf("failed to start function: %w", err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+
+	stop := func() {
+		_ = cmd.Process.Signal(os.Interrupt)
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			_ = cmd.Process.Kill()
+			<-exited
+		}
+	}
+
+	for {
+		conn, err := net.Dial("tcp", "127.0.0.1:"+port)
+		if err == nil {
+			_ = conn.Close()
+			return "http://127.0.0.1:" + port, stop, nil
+		}
+
+		select {
+		case <-exited:
+			return "", nil, errors.New("function exited before accepting connections")
+		case <-ctx.Done():
+			stop()
+			return "", nil, fmt.Errorf("function did not accept connections: %w", ctx.Err())
+		case <-time.After(25 * time.Millisecond):
+		}
+	}
+}
+
+// copyFileResp copies the file written by the function for a File response into the
+// out directory, verifying its checksum. Responses without a File body are ignored.
+func copyFileResp(respBody []byte, outDir string, stderr io.Writer) error {
+	var resp struct {
+		Body struct {
+			Filename string `json:"filename"`
+			SHA256   string `json:"sha256_checksum"`
+			Size     int64  `json:"size,string"`
+		} `json:"body"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil || resp.Body.Filename == "" || resp.Body.SHA256 == "" {
+		return nil
+	}
+	f := resp.Body
+
+	src, err := os.Open(f.Filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file response: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return fmt.Errorf("failed to create out directory: %w", err)
+	}
+
+	dest := filepath.Join(outDir, filepath.Base(f.Filename))
+	dst, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() { _ = dst.Close() }()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(dst, h), src)
+	if err != nil {
+		return fmt.Errorf("failed to copy file response: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+
+	if sum := base64.StdEncoding.EncodeToString(h.Sum(nil)); sum != f.SHA256 || n != f.Size {
+		return fmt.Errorf("file response %s does not match its metadata: got sha256 %s and size %d", f.Filename, sum, n)
+	}
+
+	fmt.Fprintf(stderr, "fninvoke: wrote file response to %s\n", dest)
+	return nil
+}
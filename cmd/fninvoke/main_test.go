@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+func TestRun(t *testing.T) {
+	tmp := t.TempDir()
+	addr := newFn(t, func(ctx context.Context, _ *slog.Logger, _ fdk.SkipCfg) fdk.Handler {
+		m := fdk.NewMux()
+		m.Post("/echo", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+			body, _ := io.ReadAll(r.Body)
+			return fdk.Response{
+				Code: http.StatusOK,
+				Body: fdk.JSON(map[string]any{
+					"body":    json.RawMessage(body),
+					"context": r.Context,
+					"header":  r.Headers.Get("X-Cs-Origin"),
+					"query":   r.Queries.Get("name"),
+					"fn_id":   r.FnID,
+				}),
+			}
+		}))
+		m.Post("/files", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+			out := map[string]string{}
+			switch b := r.Body.(type) {
+			case *fdk.ComplexPayload:
+				out["body"] = string(b.Body)
+				for name, f := range b.Files {
+					contents, _ := io.ReadAll(f)
+					out[name] = string(contents)
+				}
+			default:
+				contents, _ := io.ReadAll(b)
+				out["single"] = string(contents)
+			}
+			return fdk.Response{Code: http.StatusOK, Body: fdk.JSON(out)}
+		}))
+		m.Get("/file", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+			return fdk.Response{
+				Code: http.StatusCreated,
+				Body: fdk.File{
+					ContentType: "text/plain",
+					Filename:    filepath.Join(tmp, "written.txt"),
+					Contents:    io.NopCloser(strings.NewReader("the one ring")),
+				},
+			}
+		}))
+		return m
+	})
+
+	file1 := writeFile(t, "one.txt", "first")
+	file2 := writeFile(t, "two.txt", "second")
+
+	t.Run("JSON envelope should pass", func(t *testing.T) {
+		got, code := invoke(t, "-addr", addr, "-X", "post", "-path", "/echo",
+			"-d", `{"name":"frodo"}`, "-context", `{"app_id":"app"}`,
+			"-H", "X-Cs-Origin: local", "-q", "name=sam", "-fn-id", "fn1")
+		fdkEq(t, 0, code)
+
+		var resp struct {
+			Code int `json:"code"`
+			Body struct {
+				Body    json.RawMessage `json:"body"`
+				Context json.RawMessage `json:"context"`
+				Header  string          `json:"header"`
+				Query   string          `json:"query"`
+				FnID    string          `json:"fn_id"`
+			} `json:"body"`
+		}
+		mustUnmarshal(t, got, &resp)
+		fdkEq(t, 200, resp.Code)
+		fdkEq(t, `{"name":"frodo"}`, compact(t, resp.Body.Body))
+		fdkEq(t, `{"app_id":"app"}`, compact(t, resp.Body.Context))
+		fdkEq(t, "local", resp.Body.Header)
+		fdkEq(t, "sam", resp.Body.Query)
+		fdkEq(t, "fn1", resp.Body.FnID)
+	})
+
+	t.Run("single file multipart envelope should pass", func(t *testing.T) {
+		got, code := invoke(t, "-addr", addr, "-X", "POST", "-path", "/files", "-F", file1)
+		fdkEq(t, 0, code)
+
+		var resp struct {
+			Body map[string]string `json:"body"`
+		}
+		mustUnmarshal(t, got, &resp)
+		fdkEq(t, "first", resp.Body["single"])
+	})
+
+	t.Run("multiple files and body multipart envelope should pass", func(t *testing.T) {
+		got, code := invoke(t, "-addr", addr, "-X", "POST", "-path", "/files", "-F", file1, "-F", file2, "-d", `{"age":3}`)
+		fdkEq(t, 0, code)
+
+		var resp struct {
+			Body map[string]string `json:"body"`
+		}
+		mustUnmarshal(t, got, &resp)
+		fdkEq(t, `{"age":3}`, resp.Body["body"])
+		fdkEq(t, "first", resp.Body["one.txt"])
+		fdkEq(t, "second", resp.Body["two.txt"])
+	})
+
+	t.Run("file response should be copied to out dir", func(t *testing.T) {
+		outDir := filepath.Join(t.TempDir(), "out")
+		_, code := invoke(t, "-addr", addr, "-path", "/file", "-out", outDir)
+		fdkEq(t, 0, code)
+
+		b, err := os.ReadFile(filepath.Join(outDir, "written.txt"))
+		if err != nil {
+			t.Fatalf("failed to read copied file: %s", err)
+		}
+		fdkEq(t, "the one ring", string(b))
+	})
+
+	t.Run("error response should exit non zero", func(t *testing.T) {
+		got, code := invoke(t, "-addr", addr, "-path", "/nope")
+		fdkEq(t, 1, code)
+
+		var resp struct {
+			Errors []fdk.APIError `json:"errors"`
+		}
+		mustUnmarshal(t, got, &resp)
+		if len(resp.Errors) != 1 {
+			t.Fatalf("unexpected errors: %+v", resp.Errors)
+		}
+		fdkEq(t, http.StatusNotFound, resp.Errors[0].Code)
+	})
+
+	t.Run("invalid body should fail", func(t *testing.T) {
+		_, code := invoke(t, "-addr", addr, "-d", `{"name":`)
+		fdkEq(t, 1, code)
+	})
+}
+
+func invoke(t *testing.T, args ...string) ([]byte, int) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &stdout, &stderr)
+	t.Log(stderr.String())
+
+	status, body, _ := strings.Cut(stdout.String(), "\n")
+	if !strings.HasPrefix(status, "HTTP ") && code == 0 {
+		t.Fatalf("missing status line: %q", stdout.String())
+	}
+	return []byte(body), code
+}
+
+func newFn(t *testing.T, newHandlerFn func(context.Context, *slog.Logger, fdk.SkipCfg) fdk.Handler) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	_ = l.Close()
+	t.Setenv("PORT", port)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go fdk.Run(ctx, newHandlerFn)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if conn, err := net.Dial("tcp", "127.0.0.1:"+port); err == nil {
+			_ = conn.Close()
+			return "http://127.0.0.1:" + port
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("function did not start")
+	return ""
+}
+
+func writeFile(t *testing.T, name, contents string) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filename, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func mustUnmarshal(t *testing.T, b []byte, v any) {
+	t.Helper()
+
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatalf("failed to unmarshal: %s\n\tpayload:\t%s", err, string(b))
+	}
+}
+
+func compact(t *testing.T, b []byte) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		t.Fatalf("failed to compact json: %s", err)
+	}
+	return buf.String()
+}
+
+func fdkEq[T comparable](t *testing.T, want, got T) {
+	t.Helper()
+
+	if want != got {
+		t.Errorf("values not equal:\n\twant:\t%#v\n\tgot:\t%#v", want, got)
+	}
+}
@@ -0,0 +1,174 @@
+package fdk
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ConcurrencyStats is a snapshot of the requests being handled by the HTTP runner.
+type ConcurrencyStats struct {
+	// InFlight is the number of requests currently being dispatched.
+	InFlight int
+	// Queued is the number of requests waiting for capacity.
+	Queued int
+	// MaxInFlight is the limit of InFlight, with zero meaning no limit.
+	MaxInFlight int
+	// MaxQueue is the limit of Queued.
+	MaxQueue int
+}
+
+type ctxKeyConcurrency struct{}
+
+// ConcurrencyStatsFrom returns a snapshot of the requests being handled by the HTTP
+// runner. The stats are only available to requests dispatched by the HTTP runner.
+func ConcurrencyStatsFrom(ctx context.Context) (ConcurrencyStats, bool) {
+	l, ok := ctx.Value(ctxKeyConcurrency{}).(*concurrencyLimiter)
+	if !ok {
+		return ConcurrencyStats{}, false
+	}
+	return l.stats(), true
+}
+
+// concurrencyLimiter bounds the number of requests dispatched at once. Requests over
+// the limit wait in a short queue, if any, and are shed once the queue is full or they
+// have waited too long.
+type concurrencyLimiter struct {
+	slots        chan struct{}
+	maxQueue     int
+	queueTimeout time.Duration
+	retryAfter   time.Duration
+
+	inFlight atomic.Int64
+	queued   atomic.Int64
+}
+
+func newConcurrencyLimiter(cfg HTTPServerConfig) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		maxQueue:     cfg.MaxQueue,
+		queueTimeout: cfg.QueueTimeout,
+		retryAfter:   cfg.RetryAfter,
+	}
+	if cfg.MaxInFlight > 0 {
+		l.slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+	return l
+}
+
+func (l *concurrencyLimiter) stats() ConcurrencyStats {
+	return ConcurrencyStats{
+		InFlight:    int(l.inFlight.Load()),
+		Queued:      int(l.queued.Load()),
+		MaxInFlight: cap(l.slots),
+		MaxQueue:    l.maxQueue,
+	}
+}
+
+// acquire waits for capacity to dispatch a request. When the request is shed, the
+// returned APIError is set instead.
+func (l *concurrencyLimiter) acquire(ctx context.Context) (func(), *APIError) {
+	release := func() {
+		l.inFlight.Add(-1)
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+
+	if l.slots == nil {
+		l.inFlight.Add(1)
+		return release, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		l.inFlight.Add(1)
+		return release, nil
+	default:
+	}
+
+	if l.queued.Add(1) > int64(l.maxQueue) {
+		l.queued.Add(-1)
+		return nil, &APIError{Code: http.StatusTooManyRequests, Message: "too many requests in flight"}
+	}
+	defer l.queued.Add(-1)
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		l.inFlight.Add(1)
+		return release, nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return nil, &APIError{Code: http.StatusServiceUnavailable, Message: "timed out waiting for capacity to handle request"}
+}
+
+type ctxKeyConcurrencySlot struct{}
+
+// limitConcurrency sheds multipart requests over the limit before the request envelope
+// is read, so that shed requests don't buffer their files. JSON envelopes, whose size is
+// bounded by the max body bytes, are limited once read by limitRequest, so that the
+// health routes bypass the limit.
+func limitConcurrency(logger *slog.Logger, l *concurrencyLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), ctxKeyConcurrency{}, l)
+
+		if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+			obs := newInvocationObserver(logger, w, req)
+			release, apiErr := l.acquire(ctx)
+			if apiErr != nil {
+				// the envelope is never read, so the shed request is the zero value
+				_, span := startInvokeSpan(ctx, Request{})
+				resp := l.shed(logger, obs, *apiErr)
+				endInvokeSpan(span, resp)
+				obs.observe(Request{}, resp)
+				return
+			}
+			defer release()
+			ctx = context.WithValue(ctx, ctxKeyConcurrencySlot{}, true)
+		}
+
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// limitRequest waits for capacity to dispatch the request, unless it already holds a
+// slot or targets a health route. When the request is shed, its response is written and
+// returned along with false.
+func limitRequest(ctx context.Context, logger *slog.Logger, w http.ResponseWriter, r Request) (func(), Response, bool) {
+	l, ok := ctx.Value(ctxKeyConcurrency{}).(*concurrencyLimiter)
+	if !ok || ctx.Value(ctxKeyConcurrencySlot{}) != nil {
+		return func() {}, Response{}, true
+	}
+	if isHealthReq(r) {
+		return func() {}, Response{}, true
+	}
+
+	release, apiErr := l.acquire(ctx)
+	if apiErr != nil {
+		return nil, l.shed(logger, w, *apiErr), false
+	}
+	return release, Response{}, true
+}
+
+// shed answers a request shed by the limiter, with a Retry-After header, and returns the
+// response written.
+func (l *concurrencyLimiter) shed(logger *slog.Logger, w http.ResponseWriter, apiErr APIError) Response {
+	logger.Warn("request shed", "status_code", apiErr.Code, "reason", apiErr.Message)
+
+	retryAfter := strconv.Itoa(int(math.Ceil(l.retryAfter.Seconds())))
+	w.Header().Set("Retry-After", retryAfter)
+	resp := ErrResp(apiErr)
+	resp.Header = http.Header{"Retry-After": []string{retryAfter}}
+	if err := writeResponse(logger, w, resp); err != nil {
+		logger.Error("failed to write shed request response", "err", err)
+	}
+	return resp
+}
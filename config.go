@@ -55,6 +55,7 @@ func readCfg[T Cfg](ctx context.Context) (T, *cfgErr) {
 	err = cfg.OK()
 	if err != nil {
 		return *new(T), &cfgErr{
+			err:    err,
 			apiErr: APIError{Code: http.StatusBadRequest, Message: "config is invalid: " + err.Error()},
 		}
 	}
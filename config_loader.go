@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -21,6 +22,14 @@ type ConfigLoader interface {
 	LoadConfig(ctx context.Context) ([]byte, error)
 }
 
+// ConfigWatcher defines the behavior for a config loader that is able to signal a change
+// to the config it loads. This is an optional interface a ConfigLoader may implement to
+// support reloading the config at runtime. The returned channel should receive a value
+// whenever the config has changed and be closed when the ctx is done.
+type ConfigWatcher interface {
+	Watch(ctx context.Context) (<-chan struct{}, error)
+}
+
 // RegisterConfigLoader will register a config loader at the specified type. Similar to registering
 // a database with the database/sql, you're able to provide a config for use at runtime. During Run,
 // the config loader defined by the env var, CS_CONFIG_LOADER_TYPE, is used. If one is not provided,
@@ -34,6 +43,10 @@ func RegisterConfigLoader(loaderType string, cr ConfigLoader) {
 }
 
 func loadConfigBytes(ctx context.Context) ([]byte, error) {
+	return configLoader().LoadConfig(ctx)
+}
+
+func configLoader() ConfigLoader {
 	crt := os.Getenv("CS_CONFIG_LOADER_TYPE")
 	if crt == "" {
 		crt = "fs"
@@ -44,7 +57,7 @@ func loadConfigBytes(ctx context.Context) ([]byte, error) {
 		panic(fmt.Sprintf("unmatched config loader type provided: %q", crt))
 	}
 
-	return loader.LoadConfig(ctx)
+	return loader
 }
 
 var configReaders = map[string]ConfigLoader{
@@ -53,6 +66,8 @@ var configReaders = map[string]ConfigLoader{
 
 type localCfgLoader struct{}
 
+var _ ConfigWatcher = (*localCfgLoader)(nil)
+
 func (*localCfgLoader) LoadConfig(ctx context.Context) ([]byte, error) {
 	file := os.Getenv("CS_FN_CONFIG_PATH")
 	b, err := os.ReadFile(file)
@@ -73,3 +88,62 @@ func (*localCfgLoader) LoadConfig(ctx context.Context) ([]byte, error) {
 
 	return b, nil
 }
+
+// Watch polls the config file for changes to its modification time or size. The poll
+// interval defaults to 5s and may be set via the CS_FN_CONFIG_POLL_INTERVAL env var.
+func (*localCfgLoader) Watch(ctx context.Context) (<-chan struct{}, error) {
+	file := os.Getenv("CS_FN_CONFIG_PATH")
+
+	interval := 5 * time.Second
+	if v := os.Getenv("CS_FN_CONFIG_POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid CS_FN_CONFIG_POLL_INTERVAL provided: %q", v)
+		}
+		interval = d
+	}
+
+	type fileStat struct {
+		modTime int64
+		size    int64
+		exists  bool
+	}
+	statFn := func() fileStat {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return fileStat{}
+		}
+		return fileStat{modTime: fi.ModTime().UnixNano(), size: fi.Size(), exists: true}
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := statFn()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			cur := statFn()
+			if cur == last {
+				continue
+			}
+			last = cur
+
+			select {
+			case changes <- struct{}{}:
+			default:
+				// a change is already pending, the reload will pick up the latest
+			}
+		}
+	}()
+
+	return changes, nil
+}
@@ -0,0 +1,136 @@
+package fdk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// reloadHandler dispatches to the most recently built handler. Each request loads the
+// current handler once, so in-flight requests finish on the handler they started with
+// when a newer one is swapped in. A replaced handler is released once its last request
+// in flight completes.
+type reloadHandler struct {
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	current *handlerBox
+}
+
+// handlerBox holds a handler along with the shutdown hooks added by the constructor call
+// that built it, and the count of the requests it is serving.
+type handlerBox struct {
+	h     Handler
+	hooks *shutdownHooks
+
+	inFlight int
+	replaced bool
+}
+
+func newReloadHandler[T Cfg](ctx context.Context, logger *slog.Logger, hooksTimeout time.Duration, newHandlerFn func(context.Context, *slog.Logger, T) Handler) *reloadHandler {
+	rh := &reloadHandler{logger: logger}
+
+	build := func() (*handlerBox, error) {
+		buildCtx, hooks := newShutdownHooks(ctx, hooksTimeout, nil)
+		h, err := buildHandler(buildCtx, logger, newHandlerFn)
+		return &handlerBox{h: h, hooks: hooks}, err
+	}
+
+	box, err := build()
+	if err != nil {
+		logger.Error("failed to load initial config, serving errors until a valid config is loaded", "err", err)
+	}
+	rh.current = box
+	OnShutdown(ctx, "release handler", func(ctx context.Context) error {
+		rh.mu.Lock()
+		box := rh.current
+		rh.mu.Unlock()
+		box.release(ctx, logger)
+		return nil
+	})
+
+	switch any(*new(T)).(type) {
+	case SkipCfg, *SkipCfg:
+		return rh
+	}
+
+	watcher, ok := configLoader().(ConfigWatcher)
+	if !ok {
+		logger.Warn("config loader does not support watching for changes, config reload is disabled")
+		return rh
+	}
+
+	changes, err := watcher.Watch(ctx)
+	if err != nil {
+		panic(fmt.Sprintf("failed to watch config for changes: %s", err))
+	}
+
+	go func() {
+		for range changes {
+			box, err := build()
+			if err != nil {
+				logger.Error("failed to reload config, continuing to serve last good config", "err", err)
+				box.hooks.run(logger)
+				continue
+			}
+			rh.swap(box)
+			logger.Info("config reloaded")
+		}
+	}()
+
+	return rh
+}
+
+func (rh *reloadHandler) Handle(ctx context.Context, r Request) Response {
+	rh.mu.Lock()
+	box := rh.current
+	box.inFlight++
+	rh.mu.Unlock()
+
+	defer func() {
+		rh.mu.Lock()
+		box.inFlight--
+		drained := box.replaced && box.inFlight == 0
+		rh.mu.Unlock()
+		if drained {
+			go box.releaseDrained(rh.logger)
+		}
+	}()
+
+	return box.h.Handle(ctx, r)
+}
+
+// swap makes the provided handler the current one, releasing the replaced handler right
+// away when it has no requests in flight.
+func (rh *reloadHandler) swap(box *handlerBox) {
+	rh.mu.Lock()
+	old := rh.current
+	rh.current = box
+	old.replaced = true
+	drained := old.inFlight == 0
+	rh.mu.Unlock()
+
+	if drained {
+		old.releaseDrained(rh.logger)
+	}
+}
+
+func (b *handlerBox) releaseDrained(logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.hooks.timeout)
+	defer cancel()
+	b.release(ctx, logger)
+}
+
+// release runs the shutdown hooks of the handler, and closes the handler when it is an
+// io.Closer.
+func (b *handlerBox) release(ctx context.Context, logger *slog.Logger) {
+	b.hooks.runCtx(ctx, logger)
+	if c, ok := b.h.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			logger.Error("failed to close handler", "err", err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package fdk
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type closerHandler struct {
+	Handler
+	closed atomic.Bool
+}
+
+func (c *closerHandler) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestReloadHandler(t *testing.T) {
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	t.Run("a replaced handler should be released once its last request completes", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		old := &closerHandler{Handler: HandlerFn(func(ctx context.Context, r Request) Response {
+			close(started)
+			<-release
+			return Response{Code: http.StatusAccepted}
+		})}
+
+		_, oldHooks := newShutdownHooks(context.Background(), time.Second, nil)
+		var hookRan atomic.Bool
+		oldHooks.add(shutdownHook{name: "release", fn: func(context.Context) error {
+			hookRan.Store(true)
+			return nil
+		}})
+
+		rh := &reloadHandler{logger: logger, current: &handlerBox{h: old, hooks: oldHooks}}
+
+		done := make(chan Response, 1)
+		go func() { done <- rh.Handle(context.Background(), Request{}) }()
+		<-started
+
+		_, newHooks := newShutdownHooks(context.Background(), time.Second, nil)
+		rh.swap(&handlerBox{h: HandlerFn(func(ctx context.Context, r Request) Response {
+			return Response{Code: http.StatusOK}
+		}), hooks: newHooks})
+
+		EqualVals(t, http.StatusOK, rh.Handle(context.Background(), Request{}).Code)
+		EqualVals(t, false, old.closed.Load())
+		EqualVals(t, false, hookRan.Load())
+
+		close(release)
+		EqualVals(t, http.StatusAccepted, (<-done).Code)
+
+		deadline := time.Now().Add(2 * time.Second)
+		for !old.closed.Load() && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		EqualVals(t, true, old.closed.Load())
+		EqualVals(t, true, hookRan.Load())
+	})
+
+	t.Run("a replaced handler without requests in flight should be released right away", func(t *testing.T) {
+		old := &closerHandler{Handler: HandlerFn(func(ctx context.Context, r Request) Response {
+			return Response{Code: http.StatusOK}
+		})}
+		_, oldHooks := newShutdownHooks(context.Background(), time.Second, nil)
+		_, newHooks := newShutdownHooks(context.Background(), time.Second, nil)
+
+		rh := &reloadHandler{logger: logger, current: &handlerBox{h: old, hooks: oldHooks}}
+		EqualVals(t, http.StatusOK, rh.Handle(context.Background(), Request{}).Code)
+
+		rh.swap(&handlerBox{h: old.Handler, hooks: newHooks})
+		EqualVals(t, true, old.closed.Load())
+	})
+}
@@ -18,6 +18,7 @@ func (c config) OK() error {
 
 func newHandler(_ context.Context, logger *slog.Logger, cfg config) fdk.Handler {
 	mux := fdk.NewMux()
+	mux.Use(loggingMW(logger))
 
 	h := handler{
 		includeDrivers: cfg.IncludeMonsterDrivers,
@@ -25,8 +26,7 @@ func newHandler(_ context.Context, logger *slog.Logger, cfg config) fdk.Handler
 	}
 	h.registerRoutes(mux)
 
-	out := loggingMW(logger)(mux)
-	return out
+	return mux
 }
 
 type (
@@ -7,5 +7,5 @@ import (
 )
 
 func main() {
-	fdk.Run(context.Background(), newHandler)
+	fdk.Run(context.Background(), newHandler, fdk.WithAccessLog(fdk.AccessLogConfig{}))
 }
@@ -7,7 +7,9 @@ import (
 	fdk "github.com/CrowdStrike/foundry-fn-go"
 )
 
-func loggingMW(logger *slog.Logger) func(next fdk.Handler) fdk.Handler {
+// loggingMW logs each request as it arrives. The access log enabled in main records
+// each request once it has been handled.
+func loggingMW(logger *slog.Logger) fdk.Middleware {
 	return func(next fdk.Handler) fdk.Handler {
 		return fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
 			logger.Info("import logging here",
@@ -0,0 +1,60 @@
+package fdktest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/CrowdStrike/foundry-fn-go/jsonschema"
+)
+
+// HandlerSchemaOK validates the request body against the request schema, executes the
+// handler, and then validates the marshalled response body against the response schema.
+// An empty schema skips its validation. A failure to satisfy a schema returns an error
+// listing the JSON pointer path of each violation.
+func HandlerSchemaOK(h fdk.Handler, r fdk.Request, reqSchema, respSchema string) error {
+	if reqSchema != "" {
+		var body []byte
+		if r.Body != nil {
+			b, err := io.ReadAll(r.Body)
+			if err != nil {
+				return fmt.Errorf("failed to read request body: %w", err)
+			}
+			body = b
+		}
+		r.Body = bytes.NewReader(body)
+
+		if err := validateSchema(reqSchema, body); err != nil {
+			return fmt.Errorf("invalid request body: %w", err)
+		}
+	}
+
+	resp := h.Handle(context.Background(), r)
+
+	if respSchema != "" {
+		body := []byte("null")
+		if resp.Body != nil {
+			b, err := resp.Body.MarshalJSON()
+			if err != nil {
+				return fmt.Errorf("failed to marshal response body: %w", err)
+			}
+			body = b
+		}
+
+		if err := validateSchema(respSchema, body); err != nil {
+			return fmt.Errorf("invalid response body: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func validateSchema(schema string, body []byte) error {
+	v, err := jsonschema.NewValidator(schema)
+	if err != nil {
+		return err
+	}
+	return v.Validate(body)
+}
@@ -0,0 +1,86 @@
+package fdktest_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/CrowdStrike/foundry-fn-go/fdktest"
+)
+
+func TestHandlerSchemaOK(t *testing.T) {
+	reqSchema := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "properties": {
+    "postalCode": {
+      "type": "string",
+      "pattern": "\\d{5}"
+    }
+  },
+  "required": ["postalCode"]
+}`
+
+	respSchema := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "properties": {
+    "foo": {
+      "type": "string",
+      "enum": ["bar"]
+    }
+  },
+  "required": ["foo"]
+}`
+
+	newHandler := func(foo string) fdk.Handler {
+		return fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+			return fdk.Response{Body: fdk.JSON(map[string]string{"foo": foo})}
+		})
+	}
+
+	tests := []struct {
+		name    string
+		handler fdk.Handler
+		body    string
+		wantErr string
+	}{
+		{
+			name:    "valid request and response should pass",
+			handler: newHandler("bar"),
+			body:    `{"postalCode": "55755"}`,
+		},
+		{
+			name:    "invalid request should fail with pointer to violation",
+			handler: newHandler("bar"),
+			body:    `{"postalCode": "nope"}`,
+			wantErr: `invalid request body: schema validation failed: "#/postalCode": does not match pattern '\\d{5}'`,
+		},
+		{
+			name:    "invalid response should fail with pointer to violation",
+			handler: newHandler("baz"),
+			body:    `{"postalCode": "55755"}`,
+			wantErr: `invalid response body: schema validation failed: "#/foo": value must be "bar"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := fdk.Request{
+				URL:    "/",
+				Method: http.MethodPost,
+				Body:   strings.NewReader(tt.body),
+			}
+
+			err := fdktest.HandlerSchemaOK(tt.handler, req, reqSchema, respSchema)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %s", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("errors do not match:\n\twant:\t%s\n\tgot:\t%v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"reflect"
 )
 
 // HandlerFn wraps a function to return a handler. Similar to the http.HandlerFunc.
@@ -18,7 +19,7 @@ func (h HandlerFn) Handle(ctx context.Context, r Request) Response {
 // This normalizes the sad path and provides the caller with a zero fuss request to work with. Reducing
 // json boilerplate for what is essentially the same operation on different types.
 func HandleFnOf[T any](fn func(ctx context.Context, r RequestOf[T]) Response) Handler {
-	return HandlerFn(func(ctx context.Context, r Request) Response {
+	h := HandlerFn(func(ctx context.Context, r Request) Response {
 		var v T
 		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
 			return Response{Errors: []APIError{{Code: http.StatusBadRequest, Message: "failed to unmarshal payload: " + err.Error()}}}
@@ -37,6 +38,7 @@ func HandleFnOf[T any](fn func(ctx context.Context, r RequestOf[T]) Response) Ha
 			TraceID:     r.TraceID,
 		})
 	})
+	return handlerOf{reqType: typeOf[T](), Handler: h}
 }
 
 // HandlerFnOfOK provides a means to translate the incoming requests to the destination body type
@@ -89,12 +91,35 @@ func HandleWorkflow(fn func(ctx context.Context, r Request, wrkCtx WorkflowCtx)
 // function is useful when you expect a request body and have workflow integrations. Typically, this
 // is with PATCH/POST/PUT handlers.
 func HandleWorkflowOf[T any](fn func(ctx context.Context, r RequestOf[T], wrkCtx WorkflowCtx) Response) Handler {
-	return HandleWorkflow(func(ctx context.Context, r Request, workflowCtx WorkflowCtx) Response {
+	h := HandleWorkflow(func(ctx context.Context, r Request, workflowCtx WorkflowCtx) Response {
 		next := HandleFnOf(func(ctx context.Context, r RequestOf[T]) Response {
 			return fn(ctx, r, workflowCtx)
 		})
 		return next.Handle(ctx, r)
 	})
+	return handlerOf{reqType: typeOf[T](), Handler: h}
+}
+
+// RespondsWith declares the Go type of the response body of the handler. The handler's
+// behavior is unchanged, the type is used to describe the route in Mux.Routes and the
+// generated OpenAPI document.
+func RespondsWith[T any](h Handler) Handler {
+	out := handlerOf{Handler: h, respType: typeOf[T]()}
+	if typed, ok := h.(handlerOf); ok {
+		out.Handler, out.reqType = typed.Handler, typed.reqType
+	}
+	return out
+}
+
+// handlerOf is a handler that carries the Go types of its request and response bodies.
+type handlerOf struct {
+	Handler
+	reqType  reflect.Type
+	respType reflect.Type
+}
+
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
 }
 
 // ErrHandler creates a new handler to respond with only errors.
@@ -0,0 +1,165 @@
+package fdk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HealthCheck is a named probe of a dependency of the function, i.e. a database ping
+// or the reachability of the Falcon API.
+type HealthCheck struct {
+	// Name identifies the check in the readiness response.
+	Name string
+	// Check probes the dependency. A non-nil error fails the check.
+	Check func(ctx context.Context) error
+	// Timeout bounds the duration of the check, after which it fails. Defaults to 5s.
+	Timeout time.Duration
+	// Critical marks the function as not ready when the check fails. The failure of
+	// a non-critical check is only reported.
+	Critical bool
+}
+
+// AddHealthCheck adds a health check to the /readyz readiness route. The checks run
+// concurrently on every readiness request, and are reported individually. When any
+// critical check fails, or the runner is draining, the readiness route responds with
+// a 503. Adding a check without a name or func, or with the name of an existing check,
+// panics.
+func (m *Mux) AddHealthCheck(hc HealthCheck) {
+	if hc.Name == "" {
+		panic("health check name must be provided")
+	}
+	if hc.Check == nil {
+		panic("health check func must not be nil")
+	}
+	for _, existing := range m.healthChecks {
+		if existing.Name == hc.Name {
+			panic(fmt.Sprintf("multiple health checks added for: %q", hc.Name))
+		}
+	}
+	if hc.Timeout <= 0 {
+		hc.Timeout = 5 * time.Second
+	}
+
+	m.healthChecks = append(m.healthChecks, hc)
+}
+
+// liveness reports the function is up, along with its metadata. No health checks are
+// run, the function being able to respond is what matters.
+func liveness(ctx context.Context, r Request) Response {
+	body := map[string]string{
+		"status":           "ok",
+		"fn_id":            r.FnID,
+		"fn_build_version": os.Getenv("CS_FN_BUILD_VERSION"),
+		"fn_version":       strconv.Itoa(r.FnVersion),
+	}
+	if stats, ok := ConcurrencyStatsFrom(ctx); ok {
+		body["in_flight"] = strconv.Itoa(stats.InFlight)
+		body["queued"] = strconv.Itoa(stats.Queued)
+		body["max_in_flight"] = strconv.Itoa(stats.MaxInFlight)
+	}
+
+	return Response{
+		Code: http.StatusOK,
+		Body: JSON(body),
+	}
+}
+
+type healthCheckResult struct {
+	Status     string `json:"status"`
+	Critical   bool   `json:"critical"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// readiness runs the health checks and reports whether the function is ready to
+// handle requests.
+func (m *Mux) readiness(ctx context.Context, r Request) Response {
+	results := make(map[string]healthCheckResult, len(m.healthChecks))
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, hc := range m.healthChecks {
+		wg.Add(1)
+		go func(hc HealthCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := runHealthCheck(ctx, hc)
+
+			res := healthCheckResult{
+				Status:     "ok",
+				Critical:   hc.Critical,
+				DurationMS: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				res.Status, res.Error = "failed", err.Error()
+			}
+
+			mu.Lock()
+			results[hc.Name] = res
+			mu.Unlock()
+		}(hc)
+	}
+	wg.Wait()
+
+	var errs []APIError
+	for _, hc := range m.healthChecks {
+		if res := results[hc.Name]; hc.Critical && res.Status != "ok" {
+			errs = append(errs, APIError{
+				Code:    http.StatusServiceUnavailable,
+				Message: fmt.Sprintf("critical health check %q failed: %s", hc.Name, res.Error),
+			})
+		}
+	}
+
+	status, code := "ok", http.StatusOK
+	if len(errs) > 0 {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	if isDraining(ctx) {
+		status, code = "draining", http.StatusServiceUnavailable
+		errs = append(errs, APIError{Code: http.StatusServiceUnavailable, Message: "function is draining"})
+	}
+
+	return Response{
+		Code: code,
+		Body: JSON(map[string]any{
+			"status":     status,
+			"fn_id":      r.FnID,
+			"fn_version": strconv.Itoa(r.FnVersion),
+			"checks":     results,
+		}),
+		Errors: errs,
+	}
+}
+
+// runHealthCheck runs the check within its timeout. A check that does not return
+// within the timeout fails, without waiting on it.
+func runHealthCheck(ctx context.Context, hc HealthCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, hc.Timeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- fmt.Errorf("health check panicked: %v", r)
+			}
+		}()
+		errCh <- hc.Check(ctx)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("health check timed out after %s", hc.Timeout)
+	}
+}
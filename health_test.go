@@ -0,0 +1,160 @@
+package fdk_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+func TestMux_healthChecks(t *testing.T) {
+	type checkResult struct {
+		Status   string `json:"status"`
+		Critical bool   `json:"critical"`
+		Error    string `json:"error"`
+	}
+	type readyBody struct {
+		Status string                 `json:"status"`
+		Checks map[string]checkResult `json:"checks"`
+	}
+
+	ok := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("connection refused") }
+	hanging := func(ctx context.Context) error {
+		<-make(chan struct{})
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		checks   []fdk.HealthCheck
+		wantCode int
+		want     readyBody
+	}{
+		{
+			name:     "without checks should be ready",
+			wantCode: http.StatusOK,
+			want:     readyBody{Status: "ok", Checks: map[string]checkResult{}},
+		},
+		{
+			name: "passing checks should be ready",
+			checks: []fdk.HealthCheck{
+				{Name: "db", Check: ok, Critical: true},
+				{Name: "falcon", Check: ok},
+			},
+			wantCode: http.StatusOK,
+			want: readyBody{Status: "ok", Checks: map[string]checkResult{
+				"db":     {Status: "ok", Critical: true},
+				"falcon": {Status: "ok"},
+			}},
+		},
+		{
+			name: "failing non-critical check should be ready and report the failure",
+			checks: []fdk.HealthCheck{
+				{Name: "db", Check: ok, Critical: true},
+				{Name: "falcon", Check: failing},
+			},
+			wantCode: http.StatusOK,
+			want: readyBody{Status: "ok", Checks: map[string]checkResult{
+				"db":     {Status: "ok", Critical: true},
+				"falcon": {Status: "failed", Error: "connection refused"},
+			}},
+		},
+		{
+			name: "failing critical check should not be ready",
+			checks: []fdk.HealthCheck{
+				{Name: "db", Check: failing, Critical: true},
+				{Name: "falcon", Check: ok},
+			},
+			wantCode: http.StatusServiceUnavailable,
+			want: readyBody{Status: "unavailable", Checks: map[string]checkResult{
+				"db":     {Status: "failed", Critical: true, Error: "connection refused"},
+				"falcon": {Status: "ok"},
+			}},
+		},
+		{
+			name: "critical check exceeding its timeout should not be ready",
+			checks: []fdk.HealthCheck{
+				{Name: "db", Check: hanging, Critical: true, Timeout: 10 * time.Millisecond},
+			},
+			wantCode: http.StatusServiceUnavailable,
+			want: readyBody{Status: "unavailable", Checks: map[string]checkResult{
+				"db": {Status: "failed", Critical: true, Error: "health check timed out after 10ms"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := fdk.NewMux()
+			for _, hc := range tt.checks {
+				mux.AddHealthCheck(hc)
+			}
+
+			resp := mux.Handle(context.TODO(), fdk.Request{Method: http.MethodGet, URL: "/readyz"})
+			fdk.EqualVals(t, tt.wantCode, resp.StatusCode())
+
+			b, err := resp.Body.MarshalJSON()
+			mustNoErr(t, err)
+
+			var got readyBody
+			decodeJSON(t, b, &got)
+			fdk.EqualVals(t, tt.want.Status, got.Status)
+			if fdk.EqualVals(t, len(tt.want.Checks), len(got.Checks)) {
+				for name, want := range tt.want.Checks {
+					fdk.EqualVals(t, want, got.Checks[name], "check: %s", name)
+				}
+			}
+
+			if tt.wantCode != http.StatusOK {
+				fdk.EqualVals(t, 1, len(resp.Errors))
+			}
+
+			live := mux.Handle(context.TODO(), fdk.Request{Method: http.MethodGet, URL: "/livez"})
+			gotStatusOK(t, live)
+		})
+	}
+}
+
+func TestMux_healthChecksPanics(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+
+	tests := []struct {
+		name      string
+		checks    []fdk.HealthCheck
+		wantPanic string
+	}{
+		{
+			name:      "missing name",
+			checks:    []fdk.HealthCheck{{Check: ok}},
+			wantPanic: "health check name must be provided",
+		},
+		{
+			name:      "missing func",
+			checks:    []fdk.HealthCheck{{Name: "db"}},
+			wantPanic: "health check func must not be nil",
+		},
+		{
+			name:      "duplicate name",
+			checks:    []fdk.HealthCheck{{Name: "db", Check: ok}, {Name: "db", Check: ok}},
+			wantPanic: `multiple health checks added for: "db"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				got, _ := recover().(string)
+				fdk.EqualVals(t, tt.wantPanic, got)
+			}()
+
+			mux := fdk.NewMux()
+			for _, hc := range tt.checks {
+				mux.AddHealthCheck(hc)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package fdk
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// invocation describes a completed invocation, as recorded in the metrics and the
+// access log.
+type invocation struct {
+	route     string
+	method    string
+	resp      Response
+	duration  time.Duration
+	reqBytes  int
+	respBytes int
+	fileBytes int
+}
+
+type ctxKeyInvocationObserver struct{}
+
+// invocationObserver observes an invocation dispatched by dispatchReq, recording it in
+// the metrics and the access log. It counts the bytes of the request envelope read and
+// the response envelope written.
+type invocationObserver struct {
+	http.ResponseWriter
+
+	logger    *slog.Logger
+	metrics   *Metrics
+	accessLog *AccessLogConfig
+	start     time.Time
+	body      *readCounter
+	written   int
+	route     atomic.Value
+	fileSize  int
+}
+
+func newInvocationObserver(logger *slog.Logger, w http.ResponseWriter, req *http.Request) *invocationObserver {
+	body := &readCounter{ReadCloser: req.Body}
+	req.Body = body
+	return &invocationObserver{
+		ResponseWriter: w,
+		logger:         logger,
+		metrics:        metricsFrom(req.Context()),
+		accessLog:      runOptsFrom(req.Context()).accessLog,
+		start:          time.Now(),
+		body:           body,
+		fileSize:       -1,
+	}
+}
+
+func (o *invocationObserver) Write(p []byte) (int, error) {
+	n, err := o.ResponseWriter.Write(p)
+	o.written += n
+	return n, err
+}
+
+// withInvocationObserver makes the observer available to the Mux, so that invocations
+// are recorded by the route matched rather than the URL requested.
+func withInvocationObserver(ctx context.Context, o *invocationObserver) context.Context {
+	return context.WithValue(ctx, ctxKeyInvocationObserver{}, o)
+}
+
+// recordRoute records the route the Mux dispatched the request to.
+func recordRoute(ctx context.Context, route string) {
+	if o, ok := ctx.Value(ctxKeyInvocationObserver{}).(*invocationObserver); ok {
+		o.route.Store(route)
+	}
+}
+
+// observe records the invocation once its response is written. The request is the zero
+// value when the request envelope could not be read.
+func (o *invocationObserver) observe(r Request, resp Response) {
+	route, _ := o.route.Load().(string)
+	inv := invocation{
+		route:     route,
+		method:    r.Method,
+		resp:      resp,
+		duration:  time.Since(o.start),
+		reqBytes:  o.body.n,
+		respBytes: o.written,
+		fileBytes: o.fileSize,
+	}
+
+	o.metrics.recordInvocation(inv)
+	o.accessLog.log(o.logger, r, inv)
+}
+
+type readCounter struct {
+	io.ReadCloser
+	n int
+}
+
+func (r *readCounter) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += n
+	return n, err
+}
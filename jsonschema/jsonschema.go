@@ -0,0 +1,330 @@
+// Package jsonschema generates JSON Schema (draft 2020-12) documents from Go types. The
+// generated schemas follow the encoding/json rules for the type, so the schema describes
+// the same payload the type marshals to and unmarshals from. A field is required unless
+// its json tag has the omitempty (or omitzero) option. A required pointer, slice, or map
+// field also accepts null, the value encoding/json marshals it to when nil.
+//
+// The following struct tags add keywords to the schema of a field:
+//
+//	description:"The person's first name."  sets the description
+//	enum:"bar,baz"                           sets the allowed values, parsed per the field type
+//	pattern:"\\d{5}"                         sets the regular expression a string must match
+//	format:"email"                           sets the format of a string
+//	required:"true"                          overrides the required status derived from omitempty
+//
+// For slice and array fields, the enum, pattern, and format keywords apply to the items.
+package jsonschema
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Draft is the JSON Schema dialect of the generated schemas.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema. Only the keywords the generator emits are supported.
+type Schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Enum        []any              `json:"enum,omitempty"`
+	Pattern     string             `json:"pattern,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	AnyOf       []*Schema          `json:"anyOf,omitempty"`
+
+	AdditionalProperties *Schema `json:"additionalProperties,omitempty"`
+	ContentEncoding      string  `json:"contentEncoding,omitempty"`
+
+	Defs map[string]*Schema `json:"$defs,omitempty"`
+}
+
+// For generates a standalone schema document for the type T. Named struct types are
+// placed in the $defs of the document and referenced from where they are used.
+func For[T any]() *Schema {
+	r := NewReflector("")
+	s := r.Reflect(reflect.TypeOf((*T)(nil)).Elem())
+
+	if name := strings.TrimPrefix(s.Ref, r.refPrefix); s.Ref != "" && r.refs[name] == 1 {
+		// inline the root type when it is not referenced elsewhere, i.e. not recursive
+		root := *r.defs[name]
+		delete(r.defs, name)
+		s = &root
+	}
+	s.Schema = Draft
+	if len(r.defs) > 0 {
+		s.Defs = r.defs
+	}
+	return s
+}
+
+// WriteFile writes the schema, indented, to the named file.
+func WriteFile(filename string, s *Schema) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schema: %w", err)
+	}
+	return os.WriteFile(filename, append(b, '\n'), 0644)
+}
+
+// Reflector generates schemas for Go types, collecting the named struct types it
+// encounters as definitions so that they are generated once and may be recursive.
+type Reflector struct {
+	refPrefix string
+	defs      map[string]*Schema
+	names     map[reflect.Type]string
+	refs      map[string]int
+}
+
+// NewReflector creates a reflector. The refPrefix is prepended to the definition name
+// of every reference. When empty, it defaults to "#/$defs/". An OpenAPI document would
+// use "#/components/schemas/".
+func NewReflector(refPrefix string) *Reflector {
+	if refPrefix == "" {
+		refPrefix = "#/$defs/"
+	}
+	return &Reflector{
+		refPrefix: refPrefix,
+		defs:      make(map[string]*Schema),
+		names:     make(map[reflect.Type]string),
+		refs:      make(map[string]int),
+	}
+}
+
+// Defs returns the definitions collected by the reflector, keyed by name.
+func (r *Reflector) Defs() map[string]*Schema {
+	return r.defs
+}
+
+// Reflect generates the schema for the type. Named struct types are returned as a
+// reference to their definition.
+func (r *Reflector) Reflect(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == reflect.TypeOf(json.RawMessage{}):
+		return &Schema{}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// custom marshaling can produce anything
+		return &Schema{}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &Schema{Type: "array", Items: r.Reflect(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.Reflect(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.reflectStruct(t)
+		}
+		return r.reflectNamedStruct(t)
+	default:
+		// interfaces, and anything else, accept any value
+		return &Schema{}
+	}
+}
+
+func (r *Reflector) reflectNamedStruct(t reflect.Type) *Schema {
+	name, ok := r.names[t]
+	if !ok {
+		name = r.defName(t)
+		r.names[t] = name
+		// register before reflecting the fields to support recursive types
+		r.defs[name] = &Schema{}
+		*r.defs[name] = *r.reflectStruct(t)
+	}
+	r.refs[name]++
+	return &Schema{Ref: r.refPrefix + name}
+}
+
+func (r *Reflector) defName(t reflect.Type) string {
+	base := strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '.', c == '-':
+			return c
+		default:
+			return '_'
+		}
+	}, t.Name())
+
+	name := base
+	for i := 2; ; i++ {
+		if _, taken := r.defs[name]; !taken {
+			return name
+		}
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+}
+
+func (r *Reflector) reflectStruct(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	r.addFields(s, t)
+	return s
+}
+
+func (r *Reflector) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				// embedded struct fields are promoted, same as encoding/json
+				r.addFields(s, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fs := r.Reflect(f.Type)
+		if hasOpt(opts, "string") && fs.Ref == "" {
+			switch fs.Type {
+			case "boolean", "integer", "number":
+				fs = &Schema{Type: "string"}
+			}
+		}
+		applyTags(fs, t, f)
+
+		omitted := hasOpt(opts, "omitempty") || hasOpt(opts, "omitzero")
+		if !omitted && isNilable(f.Type) {
+			fs = nullable(fs)
+		}
+		s.Properties[name] = fs
+
+		required := !omitted
+		if v, ok := f.Tag.Lookup("required"); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				panic(fmt.Sprintf("invalid required tag on %s.%s: %q", t, f.Name, v))
+			}
+			required = b
+		}
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+func isNilable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map:
+		return true
+	default:
+		return false
+	}
+}
+
+// nullable extends the schema to accept null as well. A schema that accepts any value
+// already accepts null and is returned as is.
+func nullable(fs *Schema) *Schema {
+	if fs.Type == "" && fs.Ref == "" {
+		return fs
+	}
+	desc := fs.Description
+	fs.Description = ""
+	return &Schema{
+		Description: desc,
+		AnyOf:       []*Schema{fs, {Type: "null"}},
+	}
+}
+
+func applyTags(fs *Schema, t reflect.Type, f reflect.StructField) {
+	if v, ok := f.Tag.Lookup("description"); ok {
+		fs.Description = v
+	}
+
+	target := fs
+	if fs.Type == "array" && fs.Items != nil {
+		target = fs.Items
+	}
+
+	if v, ok := f.Tag.Lookup("enum"); ok {
+		for _, raw := range strings.Split(v, ",") {
+			val, err := parseEnumVal(target.Type, strings.TrimSpace(raw))
+			if err != nil {
+				panic(fmt.Sprintf("invalid enum tag on %s.%s: %s", t, f.Name, err))
+			}
+			target.Enum = append(target.Enum, val)
+		}
+	}
+	if v, ok := f.Tag.Lookup("pattern"); ok {
+		if _, err := regexp.Compile(v); err != nil {
+			panic(fmt.Sprintf("invalid pattern tag on %s.%s: %s", t, f.Name, err))
+		}
+		target.Pattern = v
+	}
+	if v, ok := f.Tag.Lookup("format"); ok {
+		target.Format = v
+	}
+}
+
+func parseEnumVal(typ, raw string) (any, error) {
+	switch typ {
+	case "integer":
+		return strconv.ParseInt(raw, 10, 64)
+	case "number":
+		return strconv.ParseFloat(raw, 64)
+	case "boolean":
+		return strconv.ParseBool(raw)
+	default:
+		return raw, nil
+	}
+}
+
+func hasOpt(opts, opt string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
@@ -0,0 +1,340 @@
+package jsonschema_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CrowdStrike/foundry-fn-go/jsonschema"
+)
+
+type (
+	address struct {
+		Street string `json:"street"`
+		Zip    string `json:"zip,omitempty"`
+	}
+
+	node struct {
+		Name     string  `json:"name"`
+		Children []*node `json:"children,omitempty"`
+	}
+
+	embedded struct {
+		Embedded string `json:"embedded"`
+	}
+
+	person struct {
+		embedded
+		Name      string          `json:"name"`
+		Age       int             `json:"age,omitempty"`
+		Score     float64         `json:"score"`
+		Count     int64           `json:"count,string"`
+		Active    bool            `json:"active"`
+		Tags      []string        `json:"tags"`
+		Labels    map[string]int  `json:"labels,omitempty"`
+		Address   address         `json:"address"`
+		Previous  *address        `json:"previous,omitempty"`
+		Raw       json.RawMessage `json:"raw,omitempty"`
+		Blob      []byte          `json:"blob,omitempty"`
+		CreatedAt time.Time       `json:"created_at"`
+		Anon      struct{ X int } `json:"anon"`
+		Any       any             `json:"any,omitempty"`
+		Ignored   string          `json:"-"`
+		NoTag     string
+		private   string
+		Nested    map[string]string `json:"nested,omitempty"`
+	}
+)
+
+func TestFor(t *testing.T) {
+	t.Run("struct with named nested types", func(t *testing.T) {
+		got := marshal(t, jsonschema.For[person]())
+
+		want := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "properties": {
+    "NoTag": {
+      "type": "string"
+    },
+    "active": {
+      "type": "boolean"
+    },
+    "address": {
+      "$ref": "#/$defs/address"
+    },
+    "age": {
+      "type": "integer"
+    },
+    "anon": {
+      "type": "object",
+      "properties": {
+        "X": {
+          "type": "integer"
+        }
+      },
+      "required": [
+        "X"
+      ]
+    },
+    "any": {},
+    "blob": {
+      "type": "string",
+      "contentEncoding": "base64"
+    },
+    "count": {
+      "type": "string"
+    },
+    "created_at": {
+      "type": "string",
+      "format": "date-time"
+    },
+    "embedded": {
+      "type": "string"
+    },
+    "labels": {
+      "type": "object",
+      "additionalProperties": {
+        "type": "integer"
+      }
+    },
+    "name": {
+      "type": "string"
+    },
+    "nested": {
+      "type": "object",
+      "additionalProperties": {
+        "type": "string"
+      }
+    },
+    "previous": {
+      "$ref": "#/$defs/address"
+    },
+    "raw": {},
+    "score": {
+      "type": "number"
+    },
+    "tags": {
+      "anyOf": [
+        {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        {
+          "type": "null"
+        }
+      ]
+    }
+  },
+  "required": [
+    "embedded",
+    "name",
+    "score",
+    "count",
+    "active",
+    "tags",
+    "address",
+    "created_at",
+    "anon",
+    "NoTag"
+  ],
+  "$defs": {
+    "address": {
+      "type": "object",
+      "properties": {
+        "street": {
+          "type": "string"
+        },
+        "zip": {
+          "type": "string"
+        }
+      },
+      "required": [
+        "street"
+      ]
+    }
+  }
+}`
+		equalStrings(t, want, got)
+	})
+
+	t.Run("recursive type", func(t *testing.T) {
+		got := marshal(t, jsonschema.For[node]())
+
+		want := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$ref": "#/$defs/node",
+  "$defs": {
+    "node": {
+      "type": "object",
+      "properties": {
+        "children": {
+          "type": "array",
+          "items": {
+            "$ref": "#/$defs/node"
+          }
+        },
+        "name": {
+          "type": "string"
+        }
+      },
+      "required": [
+        "name"
+      ]
+    }
+  }
+}`
+		equalStrings(t, want, got)
+	})
+
+	t.Run("nil fields should validate against the schema", func(t *testing.T) {
+		type resp struct {
+			Tags []string          `json:"tags"`
+			Next *address          `json:"next" description:"The next address."`
+			M    map[string]string `json:"m"`
+		}
+
+		v, err := jsonschema.NewValidator(marshal(t, jsonschema.For[resp]()))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		doc, err := json.Marshal(resp{})
+		if err != nil {
+			t.Fatalf("failed to marshal zero value: %s", err)
+		}
+		if err := v.Validate(doc); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+
+		err = v.Validate([]byte(`{"tags":null,"next":{"zip":"55755"},"m":null}`))
+		if err == nil {
+			t.Error("expected an invalid non-null value to fail")
+		}
+	})
+
+	t.Run("non struct type", func(t *testing.T) {
+		got := marshal(t, jsonschema.For[[]int]())
+
+		want := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "array",
+  "items": {
+    "type": "integer"
+  }
+}`
+		equalStrings(t, want, got)
+	})
+}
+
+type tagged struct {
+	PostalCode string   `json:"postalCode" description:"The postal code." pattern:"\\d{5}"`
+	Optional   string   `json:"optional,omitempty" description:"Some optional value."`
+	Foo        string   `json:"foo,omitempty" enum:"bar, baz" required:"true"`
+	Level      int      `json:"level" enum:"1,2,3" required:"false"`
+	Emails     []string `json:"emails" format:"email"`
+}
+
+func TestFor_tags(t *testing.T) {
+	got := marshal(t, jsonschema.For[tagged]())
+
+	want := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "properties": {
+    "emails": {
+      "anyOf": [
+        {
+          "type": "array",
+          "items": {
+            "type": "string",
+            "format": "email"
+          }
+        },
+        {
+          "type": "null"
+        }
+      ]
+    },
+    "foo": {
+      "type": "string",
+      "enum": [
+        "bar",
+        "baz"
+      ]
+    },
+    "level": {
+      "type": "integer",
+      "enum": [
+        1,
+        2,
+        3
+      ]
+    },
+    "optional": {
+      "type": "string",
+      "description": "Some optional value."
+    },
+    "postalCode": {
+      "type": "string",
+      "description": "The postal code.",
+      "pattern": "\\d{5}"
+    }
+  },
+  "required": [
+    "postalCode",
+    "foo",
+    "emails"
+  ]
+}`
+	equalStrings(t, want, got)
+
+	t.Run("invalid enum value should panic", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic")
+			}
+		}()
+
+		jsonschema.For[struct {
+			Level int `json:"level" enum:"one"`
+		}]()
+	})
+}
+
+func TestWriteFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "schema.json")
+
+	err := jsonschema.WriteFile(filename, jsonschema.For[tagged]())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read file: %s", err)
+	}
+	equalStrings(t, marshal(t, jsonschema.For[tagged]())+"\n", string(b))
+}
+
+func marshal(t *testing.T, s *jsonschema.Schema) string {
+	t.Helper()
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		t.Fatalf("failed to marshal schema: %s", err)
+	}
+	return string(b)
+}
+
+func equalStrings(t *testing.T, want, got string) {
+	t.Helper()
+
+	if want != got {
+		t.Errorf("values not equal:\n\twant:\t%s\n\tgot:\t%s", want, got)
+	}
+}
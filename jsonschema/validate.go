@@ -0,0 +1,96 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	tekuri "github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Validator validates JSON documents against a JSON Schema. Schemas without a $schema
+// keyword are treated as draft 2020-12.
+type Validator struct {
+	schema *tekuri.Schema
+}
+
+// NewValidator compiles the schema into a validator.
+func NewValidator(schema string) (*Validator, error) {
+	c := tekuri.NewCompiler()
+	c.Draft = tekuri.Draft2020
+
+	const url = "schema.json"
+	if err := c.AddResource(url, strings.NewReader(schema)); err != nil {
+		return nil, fmt.Errorf("failed to add schema: %w", err)
+	}
+
+	s, err := c.Compile(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema: %w", err)
+	}
+
+	return &Validator{schema: s}, nil
+}
+
+// Validate validates the JSON document. When the document does not satisfy the schema,
+// a *ValidationError is returned listing each violation.
+func (v *Validator) Validate(doc []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+
+	var val any
+	if err := dec.Decode(&val); err != nil {
+		return fmt.Errorf("failed to decode json: %w", err)
+	}
+
+	err := v.schema.Validate(val)
+	var ve *tekuri.ValidationError
+	if errors.As(err, &ve) {
+		out := new(ValidationError)
+		collectViolations(out, ve)
+		return out
+	}
+	return err
+}
+
+func collectViolations(out *ValidationError, ve *tekuri.ValidationError) {
+	if len(ve.Causes) == 0 {
+		out.Violations = append(out.Violations, Violation{
+			Path:    ve.InstanceLocation,
+			Message: ve.Message,
+		})
+		return
+	}
+	for _, cause := range ve.Causes {
+		collectViolations(out, cause)
+	}
+}
+
+// Violation is a single failure of a document to satisfy a schema.
+type Violation struct {
+	// Path is the JSON pointer to the failing value within the document. The
+	// root of the document is the empty string.
+	Path    string
+	Message string
+}
+
+// String provides a human readable violation, with the path as a JSON pointer fragment.
+func (v Violation) String() string {
+	return fmt.Sprintf("%q: %s", "#"+v.Path, v.Message)
+}
+
+// ValidationError is returned when a document fails to satisfy a schema.
+type ValidationError struct {
+	Violations []Violation
+}
+
+// Error provides a human readable error message listing every violation.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.String())
+	}
+	return "schema validation failed: " + strings.Join(msgs, "; ")
+}
@@ -0,0 +1,94 @@
+package jsonschema_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/CrowdStrike/foundry-fn-go/jsonschema"
+)
+
+func TestValidator(t *testing.T) {
+	schema := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "properties": {
+    "postalCode": {
+      "type": "string",
+      "pattern": "\\d{5}"
+    },
+    "ages": {
+      "type": "array",
+      "items": {"type": "integer"}
+    }
+  },
+  "required": ["postalCode"]
+}`
+
+	v, err := jsonschema.NewValidator(schema)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		name           string
+		doc            string
+		wantViolations []jsonschema.Violation
+	}{
+		{
+			name: "valid document should pass",
+			doc:  `{"postalCode": "55755", "ages": [1, 2]}`,
+		},
+		{
+			name: "invalid document should list each violation",
+			doc:  `{"postalCode": "abc", "ages": [1, "two"]}`,
+			wantViolations: []jsonschema.Violation{
+				{Path: "/postalCode", Message: `does not match pattern '\\d{5}'`},
+				{Path: "/ages/1", Message: "expected integer, but got string"},
+			},
+		},
+		{
+			name: "missing required property should point at the root",
+			doc:  `{}`,
+			wantViolations: []jsonschema.Violation{
+				{Path: "", Message: "missing properties: 'postalCode'"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Validate([]byte(tt.doc))
+			if len(tt.wantViolations) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			var ve *jsonschema.ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("expected a validation error, got: %v", err)
+			}
+
+			got := make(map[jsonschema.Violation]bool)
+			for _, v := range ve.Violations {
+				got[v] = true
+			}
+			if len(got) != len(tt.wantViolations) {
+				t.Errorf("number of violations mismatched:\n\twant:\t%+v\n\tgot:\t%+v", tt.wantViolations, ve.Violations)
+			}
+			for _, want := range tt.wantViolations {
+				if !got[want] {
+					t.Errorf("missing violation:\n\twant:\t%+v\n\tgot:\t%+v", want, ve.Violations)
+				}
+			}
+		})
+	}
+
+	t.Run("invalid schema should fail to compile", func(t *testing.T) {
+		_, err := jsonschema.NewValidator(`{"type": 1}`)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
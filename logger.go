@@ -0,0 +1,116 @@
+package fdk
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LoggerConfig configures the logger the runners create and hand to the handler
+// constructor. A zero value field is read from its env var, and otherwise falls back to
+// its default.
+type LoggerConfig struct {
+	// Level is the minimum level logged. A *slog.LevelVar allows the level to be changed
+	// at runtime. Set via CS_LOG_LEVEL, i.e. debug, info, warn, or error. Defaults to info.
+	Level slog.Leveler
+	// Format is the format of the logs, json or text. Set via CS_LOG_FORMAT. Defaults
+	// to json.
+	Format string
+	// Output is where the logs are written. Set via CS_LOG_OUTPUT to stdout, stderr, or
+	// the path of a file the logs are appended to. Defaults to stdout for the HTTP runner,
+	// and stderr for the runners writing their results to stdout.
+	Output io.Writer
+	// OmitSource omits the source location from the logs. Set via CS_LOG_SOURCE=false.
+	OmitSource bool
+}
+
+// WithLoggerConfig configures the logger the runners create. Fields set on the provided
+// config take precedence over their env vars.
+func WithLoggerConfig(cfg LoggerConfig) RunOpt {
+	return func(o *runOpts) {
+		o.logger = cfg
+	}
+}
+
+// WithLogHandler decorates the slog.Handler of the logger the runners create, i.e. to
+// sample the logs or to fan them out to a file. The provided func receives the handler
+// configured via WithLoggerConfig and its env vars, and may return it wrapped or a
+// handler of its own.
+func WithLogHandler(fn func(h slog.Handler) slog.Handler) RunOpt {
+	return func(o *runOpts) {
+		o.logHandler = fn
+	}
+}
+
+// newRunnerLogger creates the logger of a runner, writing to the provided output unless
+// configured otherwise. Invalid settings panic, so that the runner fails to start.
+func newRunnerLogger(o runOpts, defaultOutput io.Writer) *slog.Logger {
+	cfg, err := loggerCfg(o.logger, defaultOutput)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	opts := &slog.HandlerOptions{AddSource: !cfg.OmitSource, Level: cfg.Level}
+	var h slog.Handler = slog.NewJSONHandler(cfg.Output, opts)
+	if cfg.Format == "text" {
+		h = slog.NewTextHandler(cfg.Output, opts)
+	}
+	if o.logHandler != nil {
+		h = o.logHandler(h)
+	}
+
+	return slog.New(h)
+}
+
+func loggerCfg(cfg LoggerConfig, defaultOutput io.Writer) (LoggerConfig, error) {
+	if v := os.Getenv("CS_LOG_LEVEL"); cfg.Level == nil && v != "" {
+		var lvl slog.Level
+		if err := lvl.UnmarshalText([]byte(v)); err != nil {
+			return LoggerConfig{}, fmt.Errorf("invalid CS_LOG_LEVEL provided: %q", v)
+		}
+		cfg.Level = lvl
+	}
+	if cfg.Level == nil {
+		cfg.Level = slog.LevelInfo
+	}
+
+	if cfg.Format == "" {
+		cfg.Format = strings.ToLower(os.Getenv("CS_LOG_FORMAT"))
+	}
+	switch cfg.Format {
+	case "", "json", "text":
+	default:
+		return LoggerConfig{}, fmt.Errorf("invalid log format provided, expected json or text: %q", cfg.Format)
+	}
+
+	if v := os.Getenv("CS_LOG_SOURCE"); !cfg.OmitSource && v != "" {
+		addSource, err := strconv.ParseBool(v)
+		if err != nil {
+			return LoggerConfig{}, fmt.Errorf("invalid CS_LOG_SOURCE provided: %q", v)
+		}
+		cfg.OmitSource = !addSource
+	}
+
+	if v := os.Getenv("CS_LOG_OUTPUT"); cfg.Output == nil && v != "" {
+		switch v {
+		case "stdout":
+			cfg.Output = os.Stdout
+		case "stderr":
+			cfg.Output = os.Stderr
+		default:
+			f, err := os.OpenFile(v, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				return LoggerConfig{}, fmt.Errorf("failed to open CS_LOG_OUTPUT file: %w", err)
+			}
+			cfg.Output = f
+		}
+	}
+	if cfg.Output == nil {
+		cfg.Output = defaultOutput
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,181 @@
+package fdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewRunnerLogger(t *testing.T) {
+	type logLine struct {
+		Level  string         `json:"level"`
+		Msg    string         `json:"msg"`
+		Source map[string]any `json:"source"`
+	}
+
+	decodeLines := func(t *testing.T, b []byte) []logLine {
+		t.Helper()
+
+		var out []logLine
+		for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+			if line == "" {
+				continue
+			}
+			var l logLine
+			mustNoErrInternal(t, json.Unmarshal([]byte(line), &l))
+			out = append(out, l)
+		}
+		return out
+	}
+
+	logAll := func(logger *slog.Logger) {
+		logger.Debug("debug line")
+		logger.Info("info line")
+		logger.Warn("warn line")
+	}
+
+	t.Run("defaults should log json at info with the source", func(t *testing.T) {
+		var buf bytes.Buffer
+		logAll(newRunnerLogger(runOpts{}, &buf))
+
+		lines := decodeLines(t, buf.Bytes())
+		if EqualVals(t, 2, len(lines)) {
+			EqualVals(t, "info line", lines[0].Msg)
+			EqualVals(t, "warn line", lines[1].Msg)
+			EqualVals(t, true, lines[0].Source != nil)
+		}
+	})
+
+	t.Run("env vars should set the level, format, and source", func(t *testing.T) {
+		t.Setenv("CS_LOG_LEVEL", "warn")
+		t.Setenv("CS_LOG_FORMAT", "text")
+		t.Setenv("CS_LOG_SOURCE", "false")
+
+		var buf bytes.Buffer
+		logAll(newRunnerLogger(runOpts{}, &buf))
+
+		got := strings.TrimSpace(buf.String())
+		EqualVals(t, true, strings.HasSuffix(got, `level=WARN msg="warn line"`), "got: %s", got)
+		EqualVals(t, 1, strings.Count(got, "\n")+1)
+	})
+
+	t.Run("env output should append to the file", func(t *testing.T) {
+		logFile := filepath.Join(t.TempDir(), "fn.log")
+		writeTestFile(t, logFile, `{"level":"INFO","msg":"previous line"}`+"\n")
+		t.Setenv("CS_LOG_OUTPUT", logFile)
+
+		var buf bytes.Buffer
+		newRunnerLogger(runOpts{}, &buf).Info("info line")
+
+		EqualVals(t, 0, buf.Len())
+		lines := decodeLines(t, []byte(readTestFile(t, logFile)))
+		if EqualVals(t, 2, len(lines)) {
+			EqualVals(t, "previous line", lines[0].Msg)
+			EqualVals(t, "info line", lines[1].Msg)
+		}
+	})
+
+	t.Run("config should take precedence over the env vars", func(t *testing.T) {
+		t.Setenv("CS_LOG_LEVEL", "error")
+		t.Setenv("CS_LOG_FORMAT", "text")
+
+		var lvl slog.LevelVar
+		lvl.Set(slog.LevelDebug)
+
+		var buf bytes.Buffer
+		o := runOpts{logger: LoggerConfig{Level: &lvl, Format: "json", Output: &buf, OmitSource: true}}
+		logger := newRunnerLogger(o, new(bytes.Buffer))
+		logAll(logger)
+
+		lines := decodeLines(t, buf.Bytes())
+		if EqualVals(t, 3, len(lines)) {
+			EqualVals(t, "debug line", lines[0].Msg)
+			EqualVals(t, true, lines[0].Source == nil)
+		}
+
+		buf.Reset()
+		lvl.Set(slog.LevelWarn)
+		logAll(logger)
+		EqualVals(t, 1, len(decodeLines(t, buf.Bytes())))
+	})
+
+	t.Run("invalid settings should panic", func(t *testing.T) {
+		tests := []struct {
+			env       string
+			val       string
+			wantPanic string
+		}{
+			{env: "CS_LOG_LEVEL", val: "loud", wantPanic: `invalid CS_LOG_LEVEL provided: "loud"`},
+			{env: "CS_LOG_FORMAT", val: "xml", wantPanic: `invalid log format provided, expected json or text: "xml"`},
+			{env: "CS_LOG_SOURCE", val: "maybe", wantPanic: `invalid CS_LOG_SOURCE provided: "maybe"`},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.env, func(t *testing.T) {
+				t.Setenv(tt.env, tt.val)
+
+				defer func() {
+					got, _ := recover().(string)
+					EqualVals(t, tt.wantPanic, got)
+				}()
+
+				newRunnerLogger(runOpts{}, new(bytes.Buffer))
+			})
+		}
+	})
+
+	t.Run("log handler should decorate the configured handler", func(t *testing.T) {
+		var buf, fanout bytes.Buffer
+		o := runOpts{logHandler: func(h slog.Handler) slog.Handler {
+			return &fanoutHandler{handlers: []slog.Handler{h, slog.NewJSONHandler(&fanout, nil)}}
+		}}
+		newRunnerLogger(o, &buf).Info("info line")
+
+		EqualVals(t, 1, len(decodeLines(t, buf.Bytes())))
+		EqualVals(t, 1, len(decodeLines(t, fanout.Bytes())))
+	})
+}
+
+type fanoutHandler struct {
+	handlers []slog.Handler
+}
+
+func (f *fanoutHandler) Enabled(ctx context.Context, lvl slog.Level) bool {
+	for _, h := range f.handlers {
+		if h.Enabled(ctx, lvl) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	for _, h := range f.handlers {
+		if h.Enabled(ctx, r.Level) {
+			if err := h.Handle(ctx, r.Clone()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := &fanoutHandler{}
+	for _, h := range f.handlers {
+		out.handlers = append(out.handlers, h.WithAttrs(attrs))
+	}
+	return out
+}
+
+func (f *fanoutHandler) WithGroup(name string) slog.Handler {
+	out := &fanoutHandler{}
+	for _, h := range f.handlers {
+		out.handlers = append(out.handlers, h.WithGroup(name))
+	}
+	return out
+}
@@ -0,0 +1,454 @@
+package fdk
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics is a registry of metrics, exposed in the Prometheus text format. Run records
+// the built-in request metrics to its registry, which functions may add their own
+// metrics to via MetricsFrom. A Metrics is an http.Handler serving its metrics.
+//
+// Registering a metric that already exists returns the existing metric, so that a
+// handler constructor may register its metrics on every call. Registering a metric
+// with an invalid name, or with the name of a metric of another type or other labels,
+// panics.
+type Metrics struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+
+	requests  *Counter
+	errors    *Counter
+	panics    *Counter
+	duration  *Histogram
+	reqBytes  *Histogram
+	respBytes *Histogram
+	fileBytes *Histogram
+}
+
+var (
+	// DefaultDurationBuckets are the default buckets of a Histogram, suited to request
+	// durations in seconds.
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// DefaultSizeBuckets are buckets suited to sizes in bytes, from 256B to 64MB.
+	DefaultSizeBuckets = []float64{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20}
+)
+
+// MetricsConfig configures how the HTTP runner exposes the metrics. The metrics are
+// recorded regardless, and are not exposed unless a Route or Addr is set. A zero value
+// field is read from its env var.
+type MetricsConfig struct {
+	// Route is the path the metrics are served on, i.e. /metrics. Without an Addr, the
+	// metrics are served by the server handling the invocations. Set via CS_METRICS_ROUTE.
+	// Defaults to /metrics when an Addr is set.
+	Route string
+	// Addr is the address of a separate server the metrics are served on, i.e. :9090,
+	// keeping the metrics off the port handling the invocations. Set via CS_METRICS_ADDR.
+	Addr string
+}
+
+// WithMetricsConfig configures how the HTTP runner exposes the metrics. Fields set on the
+// provided config take precedence over their env vars.
+func WithMetricsConfig(cfg MetricsConfig) RunOpt {
+	return func(o *runOpts) {
+		o.metrics = cfg
+	}
+}
+
+func metricsCfg(cfg MetricsConfig) (MetricsConfig, error) {
+	if cfg.Route == "" {
+		cfg.Route = os.Getenv("CS_METRICS_ROUTE")
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = os.Getenv("CS_METRICS_ADDR")
+	}
+	if cfg.Route == "" && cfg.Addr != "" {
+		cfg.Route = "/metrics"
+	}
+	if cfg.Route != "" && (!strings.HasPrefix(cfg.Route, "/") || cfg.Route == "/") {
+		return MetricsConfig{}, fmt.Errorf("invalid metrics route provided, must be a path other than /: %q", cfg.Route)
+	}
+	return cfg, nil
+}
+
+// serveMetrics serves the metrics on the separate server of the config. The returned
+// func shuts the server down.
+func serveMetrics(logger *slog.Logger, cfg MetricsConfig, m *Metrics) (func(), error) {
+	l, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Route, m)
+	s := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		logger.Info("serving metrics on " + l.Addr().String() + cfg.Route)
+		if err := s.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("unexpected shutdown of metrics server", "err", err)
+		}
+	}()
+
+	return func() {
+		if err := s.Close(); err != nil {
+			logger.Error("failed to close metrics server", "err", err)
+		}
+		<-done
+	}, nil
+}
+
+func newMetrics() *Metrics {
+	m := &Metrics{families: make(map[string]*metricFamily)}
+
+	m.requests = m.Counter("fn_requests_total", "Requests handled by route, method and response status class.", "route", "method", "status_class")
+	m.errors = m.Counter("fn_response_errors_total", "Errors of the responses by route, method and error code.", "route", "method", "code")
+	m.panics = m.Counter("fn_panics_total", "Panics caught while handling requests.")
+	m.duration = m.Histogram("fn_request_duration_seconds", "Duration of the requests by route and method.", DefaultDurationBuckets, "route", "method")
+	m.reqBytes = m.Histogram("fn_request_size_bytes", "Size of the request envelopes by route and method.", DefaultSizeBuckets, "route", "method")
+	m.respBytes = m.Histogram("fn_response_size_bytes", "Size of the response envelopes by route and method.", DefaultSizeBuckets, "route", "method")
+	m.fileBytes = m.Histogram("fn_file_size_bytes", "Size of the File responses written by route and method.", DefaultSizeBuckets, "route", "method")
+
+	return m
+}
+
+type ctxKeyMetrics struct{}
+
+func withMetrics(ctx context.Context, m *Metrics) context.Context {
+	return context.WithValue(ctx, ctxKeyMetrics{}, m)
+}
+
+// MetricsFrom returns the metrics registry of Run, for functions to record their own
+// metrics alongside the built-in ones, i.e.:
+//
+//	func newHandler(ctx context.Context, logger *slog.Logger, cfg config) fdk.Handler {
+//		lookups := fdk.MetricsFrom(ctx).Counter("people_lookups_total", "People looked up by source.", "source")
+//		...
+//		lookups.Inc("cache")
+//	}
+//
+// Outside of Run, the metrics are recorded to a registry that is not exposed.
+func MetricsFrom(ctx context.Context) *Metrics {
+	if m := metricsFrom(ctx); m != nil {
+		return m
+	}
+	return newMetrics()
+}
+
+func metricsFrom(ctx context.Context) *Metrics {
+	m, _ := ctx.Value(ctxKeyMetrics{}).(*Metrics)
+	return m
+}
+
+// Counter registers a counter, a value that only goes up, partitioned by the provided
+// label names.
+func (m *Metrics) Counter(name, help string, labelNames ...string) *Counter {
+	return &Counter{f: m.register(name, help, "counter", nil, labelNames)}
+}
+
+// Gauge registers a gauge, a value that goes up and down, partitioned by the provided
+// label names.
+func (m *Metrics) Gauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{f: m.register(name, help, "gauge", nil, labelNames)}
+}
+
+// Histogram registers a histogram, counting observations into the provided buckets of
+// upper bounds, partitioned by the provided label names. When no buckets are provided,
+// the DefaultDurationBuckets are used.
+func (m *Metrics) Histogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	buckets = slices.Clone(buckets)
+	sort.Float64s(buckets)
+	return &Histogram{f: m.register(name, help, "histogram", buckets, labelNames)}
+}
+
+var (
+	metricNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRe  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+func (m *Metrics) register(name, help, typ string, buckets []float64, labelNames []string) *metricFamily {
+	if !metricNameRe.MatchString(name) {
+		panic(fmt.Sprintf("invalid metric name: %q", name))
+	}
+	for _, l := range labelNames {
+		if !labelNameRe.MatchString(l) || strings.HasPrefix(l, "__") || l == "le" {
+			panic(fmt.Sprintf("invalid label name for metric %q: %q", name, l))
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.families == nil {
+		// nil check, make the zero value useful
+		m.families = make(map[string]*metricFamily)
+	}
+	if f, ok := m.families[name]; ok {
+		if f.typ != typ || !slices.Equal(f.labelNames, labelNames) || !slices.Equal(f.buckets, buckets) {
+			panic(fmt.Sprintf("metric already registered with a different type, labels or buckets: %q", name))
+		}
+		return f
+	}
+
+	f := &metricFamily{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: slices.Clone(labelNames),
+		buckets:    buckets,
+		series:     make(map[string]*metricSeries),
+	}
+	m.families[name] = f
+	return f
+}
+
+// Counter is a metric that only goes up.
+type Counter struct {
+	f *metricFamily
+}
+
+// Inc increments the counter of the provided label values by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds the provided value to the counter of the provided label values. Adding a
+// negative value panics.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %q cannot decrease", c.f.name))
+	}
+	c.f.update(labelValues, func(s *metricSeries) { s.value += v })
+}
+
+// Gauge is a metric that goes up and down.
+type Gauge struct {
+	f *metricFamily
+}
+
+// Set sets the gauge of the provided label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.update(labelValues, func(s *metricSeries) { s.value = v })
+}
+
+// Add adds the provided value, which may be negative, to the gauge of the provided
+// label values.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.f.update(labelValues, func(s *metricSeries) { s.value += v })
+}
+
+// Histogram is a metric that counts observations into buckets.
+type Histogram struct {
+	f *metricFamily
+}
+
+// Observe records the value in the histogram of the provided label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.update(labelValues, func(s *metricSeries) {
+		if s.bucketCounts == nil {
+			s.bucketCounts = make([]uint64, len(h.f.buckets))
+		}
+		for i, upper := range h.f.buckets {
+			if v <= upper {
+				s.bucketCounts[i]++
+			}
+		}
+		s.value += v
+		s.count++
+	})
+}
+
+type metricFamily struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+// metricSeries is the value of a metric for one set of label values. The value is the
+// sum of the observations for a histogram, whose bucket counts are cumulative.
+type metricSeries struct {
+	labelValues  []string
+	value        float64
+	count        uint64
+	bucketCounts []uint64
+}
+
+func (f *metricFamily) update(labelValues []string, fn func(s *metricSeries)) {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %q expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: slices.Clone(labelValues)}
+		f.series[key] = s
+	}
+	fn(s)
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.WriteText(w)
+}
+
+// WriteText writes the metrics to the writer in the Prometheus text format.
+func (m *Metrics) WriteText(w io.Writer) error {
+	m.mu.Lock()
+	families := make([]*metricFamily, 0, len(m.families))
+	for _, f := range m.families {
+		families = append(families, f)
+	}
+	m.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.writeTo(bw)
+	}
+	return bw.Flush()
+}
+
+func (f *metricFamily) writeTo(w *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := f.series[k]
+		if f.typ != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.labels(s.labelValues, ""), formatFloat(s.value))
+			continue
+		}
+		for i, upper := range f.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labels(s.labelValues, formatFloat(upper)), s.bucketCounts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labels(s.labelValues, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labels(s.labelValues, ""), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labels(s.labelValues, ""), s.count)
+	}
+}
+
+func (f *metricFamily) labels(values []string, le string) string {
+	if len(values) == 0 && le == "" {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range f.labelNames {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name + `="` + escapeLabelValue(values[i]) + `"`)
+	}
+	if le != "" {
+		if len(values) > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(`le="` + le + `"`)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func (m *Metrics) recordPanic() {
+	if m == nil {
+		return
+	}
+	m.panics.Inc()
+}
+
+// recordInvocation records the built-in metrics of the invocation.
+func (m *Metrics) recordInvocation(inv invocation) {
+	if m == nil {
+		return
+	}
+
+	route, method := inv.route, metricsMethod(inv.method)
+	m.requests.Inc(route, method, strconv.Itoa(inv.resp.StatusCode()/100)+"xx")
+	for _, e := range inv.resp.Errors {
+		m.errors.Inc(route, method, strconv.Itoa(e.Code))
+	}
+	m.duration.Observe(inv.duration.Seconds(), route, method)
+	m.reqBytes.Observe(float64(inv.reqBytes), route, method)
+	m.respBytes.Observe(float64(inv.respBytes), route, method)
+	if inv.fileBytes >= 0 {
+		m.fileBytes.Observe(float64(inv.fileBytes), route, method)
+	}
+}
+
+// metricsMethod bounds the method label to the standard methods, as the method is set
+// by the caller. Any other method is recorded as other.
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodPatch, http.MethodPost, http.MethodPut:
+		return method
+	}
+	return "other"
+}
@@ -0,0 +1,120 @@
+package fdk
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetrics_writeText(t *testing.T) {
+	var m Metrics
+
+	lookups := m.Counter("people_lookups_total", "People looked up by source.", "source")
+	lookups.Inc("cache")
+	lookups.Add(2, "cache")
+	lookups.Inc(`db "primary"`)
+
+	inFlight := m.Gauge("people_in_flight", "People lookups in flight.\nPer process.")
+	inFlight.Set(3)
+	inFlight.Add(-1)
+
+	latency := m.Histogram("people_lookup_seconds", "Latency of people lookups.", []float64{1, 0.1}, "source")
+	latency.Observe(0.05, "db")
+	latency.Observe(0.5, "db")
+	latency.Observe(2, "db")
+
+	// registering again returns the existing metric
+	m.Counter("people_lookups_total", "People looked up by source.", "source").Inc("cache")
+
+	var buf bytes.Buffer
+	mustNoErrInternal(t, m.WriteText(&buf))
+
+	want := `# HELP people_in_flight People lookups in flight.\nPer process.
+# TYPE people_in_flight gauge
+people_in_flight 2
+# HELP people_lookup_seconds Latency of people lookups.
+# TYPE people_lookup_seconds histogram
+people_lookup_seconds_bucket{source="db",le="0.1"} 1
+people_lookup_seconds_bucket{source="db",le="1"} 2
+people_lookup_seconds_bucket{source="db",le="+Inf"} 3
+people_lookup_seconds_sum{source="db"} 2.55
+people_lookup_seconds_count{source="db"} 3
+# HELP people_lookups_total People looked up by source.
+# TYPE people_lookups_total counter
+people_lookups_total{source="cache"} 4
+people_lookups_total{source="db \"primary\""} 1
+`
+	EqualVals(t, want, buf.String())
+}
+
+func TestMetrics_panics(t *testing.T) {
+	tests := []struct {
+		name      string
+		fn        func(m *Metrics)
+		wantPanic string
+	}{
+		{
+			name:      "invalid metric name",
+			fn:        func(m *Metrics) { m.Counter("people-lookups", "") },
+			wantPanic: `invalid metric name: "people-lookups"`,
+		},
+		{
+			name:      "invalid label name",
+			fn:        func(m *Metrics) { m.Histogram("lookup_seconds", "", nil, "le") },
+			wantPanic: `invalid label name for metric "lookup_seconds": "le"`,
+		},
+		{
+			name: "metric registered with another type",
+			fn: func(m *Metrics) {
+				m.Counter("lookups", "")
+				m.Gauge("lookups", "")
+			},
+			wantPanic: `metric already registered with a different type, labels or buckets: "lookups"`,
+		},
+		{
+			name: "metric registered with other labels",
+			fn: func(m *Metrics) {
+				m.Counter("lookups", "", "source")
+				m.Counter("lookups", "", "region")
+			},
+			wantPanic: `metric already registered with a different type, labels or buckets: "lookups"`,
+		},
+		{
+			name:      "mismatched label values",
+			fn:        func(m *Metrics) { m.Counter("lookups", "", "source").Inc() },
+			wantPanic: `metric "lookups" expects 1 label values, got 0`,
+		},
+		{
+			name:      "decreasing counter",
+			fn:        func(m *Metrics) { m.Counter("lookups", "").Add(-1) },
+			wantPanic: `counter "lookups" cannot decrease`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				got, _ := recover().(string)
+				EqualVals(t, tt.wantPanic, got)
+			}()
+
+			tt.fn(new(Metrics))
+		})
+	}
+}
+
+func TestMetrics_recordInvocation(t *testing.T) {
+	m := newMetrics()
+	for _, method := range []string{http.MethodGet, "BREW", "get", "PROPFIND"} {
+		m.recordInvocation(invocation{route: "/coffee", method: method, resp: Response{Code: http.StatusOK}, fileBytes: -1})
+	}
+
+	var buf bytes.Buffer
+	mustNoErrInternal(t, m.WriteText(&buf))
+
+	got := buf.String()
+	EqualVals(t, true, strings.Contains(got, `fn_requests_total{route="/coffee",method="GET",status_class="2xx"} 1`), "got: %s", got)
+	EqualVals(t, true, strings.Contains(got, `fn_requests_total{route="/coffee",method="other",status_class="2xx"} 3`), "got: %s", got)
+	EqualVals(t, false, strings.Contains(got, "BREW"), "got: %s", got)
+}
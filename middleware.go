@@ -0,0 +1,71 @@
+package fdk
+
+import (
+	"strings"
+)
+
+// Middleware decorates a handler with additional behavior.
+type Middleware func(Handler) Handler
+
+// Chain wraps the handler with the middleware. The first middleware provided is the
+// outermost, and is the first to see the request and the last to see the response.
+func Chain(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// Group registers routes that share a path prefix and middleware. A Group is created
+// with Mux.Group.
+type Group struct {
+	mux    *Mux
+	prefix string
+	mws    []Middleware
+}
+
+// Group creates a sub group of routes that share the provided prefix in addition to this
+// group's prefix. The middleware provided is applied within this group's middleware.
+func (g *Group) Group(prefix string, mws ...Middleware) *Group {
+	return &Group{
+		mux:    g.mux,
+		prefix: joinRoute(g.prefix, prefix),
+		mws:    append(append([]Middleware{}, g.mws...), mws...),
+	}
+}
+
+// Delete creates a DELETE route.
+func (g *Group) Delete(route string, h Handler, mws ...Middleware) {
+	g.registerRoute(g.mux.Delete, route, h, mws)
+}
+
+// Get creates a GET route.
+func (g *Group) Get(route string, h Handler, mws ...Middleware) {
+	g.registerRoute(g.mux.Get, route, h, mws)
+}
+
+// Patch creates a PATCH route.
+func (g *Group) Patch(route string, h Handler, mws ...Middleware) {
+	g.registerRoute(g.mux.Patch, route, h, mws)
+}
+
+// Post creates a POST route.
+func (g *Group) Post(route string, h Handler, mws ...Middleware) {
+	g.registerRoute(g.mux.Post, route, h, mws)
+}
+
+// Put creates a PUT route.
+func (g *Group) Put(route string, h Handler, mws ...Middleware) {
+	g.registerRoute(g.mux.Put, route, h, mws)
+}
+
+func (g *Group) registerRoute(registerFn func(string, Handler, ...Middleware), route string, h Handler, mws []Middleware) {
+	if h == nil {
+		panic("handler must not be nil")
+	}
+	registerFn(joinRoute(g.prefix, route), h, append(append([]Middleware{}, g.mws...), mws...)...)
+}
+
+func joinRoute(prefix, route string) string {
+	return strings.TrimSuffix(prefix, "/") + route
+}
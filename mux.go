@@ -4,23 +4,58 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"os"
-	"strconv"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	healthzRoute  = "/healthz"
+	livezRoute    = "/livez"
+	readyzRoute   = "/readyz"
 	healthzMethod = http.MethodGet
 )
 
 // Mux defines a handler that will dispatch to a matching route/method combination. Much
 // like the std lib http.ServeMux, but with slightly more opinionated route setting. We
-// only support the DELETE, GET, POST, and PUT.
+// support the DELETE, GET, PATCH, POST, and PUT methods. Every GET route additionally
+// responds to HEAD, with the response body stripped, and every route responds to OPTIONS
+// with the allowed methods. A request with a method that is not allowed receives the
+// allowed methods in the Allow header of the response.
+//
+// Routes may contain named path parameters, i.e. /people/{id}, and a trailing wildcard
+// that matches the remainder of the path, i.e. /files/{path...}, which must hold at
+// least one segment. The matched values are available via PathParam. Static routes take
+// precedence over pattern routes. Between pattern routes, comparing segments left to
+// right, a literal segment takes precedence over a parameter, which takes precedence
+// over a wildcard. Registering two patterns that match the same paths for the same
+// method panics.
+//
+// The mux provides the built-in /healthz and /livez liveness routes, and the /readyz
+// readiness route which runs the health checks added via AddHealthCheck. Each may be
+// overridden by registering a GET handler for its route.
+//
+// Middleware is applied in the following order, from outermost to innermost: the
+// recoverer applied by Run, the mux middleware added via Use, the middleware of each
+// enclosing Group, and finally the middleware provided when registering the route. The
+// mux middleware wraps all requests dispatched by the mux, including the built-in
+// health routes and the not found and method not allowed responses. Middleware that
+// should not apply to the health routes, i.e. authorization, belongs on a Group.
 type Mux struct {
 	routes      map[string]bool
 	meth2Routes map[string]map[string]bool
+	patterns    []routePattern
 
 	handlers map[routeKey]Handler
+	infos    map[routeKey]RouteInfo
+
+	healthChecks []HealthCheck
+
+	mws   []Middleware
+	chain Handler
 }
 
 // NewMux creates a new Mux that is ready for assignment.
@@ -31,17 +66,9 @@ func NewMux() *Mux {
 		handlers:    make(map[routeKey]Handler),
 	}
 
-	m.Get(healthzRoute, HandlerFn(func(ctx context.Context, r Request) Response {
-		return Response{
-			Code: http.StatusOK,
-			Body: JSON(map[string]string{
-				"status":           "ok",
-				"fn_id":            r.FnID,
-				"fn_build_version": os.Getenv("CS_FN_BUILD_VERSION"),
-				"fn_version":       strconv.Itoa(r.FnVersion),
-			}),
-		}
-	}))
+	m.Get(healthzRoute, HandlerFn(liveness))
+	m.Get(livezRoute, HandlerFn(liveness))
+	m.Get(readyzRoute, HandlerFn(m.readiness))
 
 	return m
 }
@@ -49,55 +76,190 @@ func NewMux() *Mux {
 // Handle enacts the handler to process the request/response lifecycle. The mux fulfills the
 // Handler interface and can dispatch to any number of sub routes.
 func (m *Mux) Handle(ctx context.Context, r Request) Response {
-	route := r.URL
-	if route == "" {
-		route = "/"
+	if m.chain != nil {
+		return m.chain.Handle(ctx, r)
+	}
+	return m.dispatch(ctx, r)
+}
+
+// Use adds middleware that wraps every request dispatched by the mux. Middleware is
+// applied in the order it is added, with the first added being the outermost.
+func (m *Mux) Use(mws ...Middleware) {
+	m.mws = append(m.mws, mws...)
+	m.chain = Chain(HandlerFn(m.dispatch), m.mws...)
+}
+
+// Group creates a group of routes that share the provided prefix and middleware. The
+// group middleware is applied within the mux middleware and outside any middleware
+// provided when registering a route.
+func (m *Mux) Group(prefix string, mws ...Middleware) *Group {
+	return &Group{
+		mux:    m,
+		prefix: prefix,
+		mws:    append([]Middleware{}, mws...),
 	}
+}
 
-	rk := routeKey{route: route, method: r.Method}
-	if !m.routes[rk.route] {
+func (m *Mux) dispatch(ctx context.Context, r Request) Response {
+	route := routeOf(r)
+
+	// candidate routes are in order of precedence, static route first
+	var candidates []string
+	if m.routes[route] && !isPatternRoute(route) {
+		candidates = append(candidates, route)
+	}
+	for _, p := range m.patterns {
+		if _, ok := p.match(route); ok {
+			candidates = append(candidates, p.shape)
+		}
+	}
+
+	if len(candidates) == 0 {
 		return Response{Errors: []APIError{{Code: http.StatusNotFound, Message: "route not found"}}}
 	}
-	if !m.meth2Routes[rk.method][rk.route] {
-		return Response{Errors: []APIError{{Code: http.StatusMethodNotAllowed, Message: "method not allowed"}}}
+
+	if r.Method == http.MethodOptions {
+		return Response{
+			Code:   http.StatusNoContent,
+			Header: http.Header{"Allow": []string{m.allowedMethods(candidates)}},
+		}
+	}
+
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	for _, candidate := range candidates {
+		if !m.meth2Routes[method][candidate] {
+			continue
+		}
+		rk := routeKey{route: candidate, method: method}
+		h := m.handlers[rk] // check above guarantees this exists here
+		info := m.infos[rk]
+		if info.Route != "" {
+			ctx = withLogger(ctx, LoggerFrom(ctx).With("route", info.Route))
+			recordRoute(ctx, info.Route)
+		}
+		ctx, span := startSpan(ctx, "fn.mux.dispatch", trace.WithAttributes(
+			attribute.String("http.route", info.Route),
+			attribute.String("http.request.method", r.Method),
+		))
+		resp := h.Handle(ctx, r)
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode()))
+		span.End()
+		if r.Method == http.MethodHead {
+			resp = stripBody(resp)
+		}
+		return resp
+	}
+
+	return Response{
+		Errors: []APIError{{Code: http.StatusMethodNotAllowed, Message: "method not allowed"}},
+		Header: http.Header{"Allow": []string{m.allowedMethods(candidates)}},
+	}
+}
+
+func (m *Mux) allowedMethods(routes []string) string {
+	var methods []string
+	for method, m2r := range m.meth2Routes {
+		for _, route := range routes {
+			if m2r[route] {
+				methods = append(methods, method)
+				break
+			}
+		}
+	}
+	for _, method := range methods {
+		if method == http.MethodGet {
+			methods = append(methods, http.MethodHead)
+			break
+		}
+	}
+	methods = append(methods, http.MethodOptions)
+	sort.Strings(methods)
+
+	return strings.Join(methods, ", ")
+}
+
+func stripBody(resp Response) Response {
+	if f, ok := resp.Body.(File); ok && f.Contents != nil {
+		_ = f.Contents.Close()
 	}
+	resp.Body = nil
+	return resp
+}
+
+// Delete creates a DELETE route. The middleware provided is applied to this route only.
+func (m *Mux) Delete(route string, h Handler, mws ...Middleware) {
+	m.registerRoute(http.MethodDelete, route, h, mws...)
+}
+
+// Get creates a GET route. The middleware provided is applied to this route only.
+func (m *Mux) Get(route string, h Handler, mws ...Middleware) {
+	m.registerRoute(http.MethodGet, route, h, mws...)
+}
 
-	h := m.handlers[rk] // checks above guarantee this exists here
-	return h.Handle(ctx, r)
+// Patch creates a PATCH route. The middleware provided is applied to this route only.
+func (m *Mux) Patch(route string, h Handler, mws ...Middleware) {
+	m.registerRoute(http.MethodPatch, route, h, mws...)
 }
 
-// Delete creates a DELETE route.
-func (m *Mux) Delete(route string, h Handler) {
-	m.registerRoute(http.MethodDelete, route, h)
+// Post creates a POST route. The middleware provided is applied to this route only.
+func (m *Mux) Post(route string, h Handler, mws ...Middleware) {
+	m.registerRoute(http.MethodPost, route, h, mws...)
 }
 
-// Get creates a GET route.
-func (m *Mux) Get(route string, h Handler) {
-	m.registerRoute(http.MethodGet, route, h)
+// Put creates a PUT route. The middleware provided is applied to this route only.
+func (m *Mux) Put(route string, h Handler, mws ...Middleware) {
+	m.registerRoute(http.MethodPut, route, h, mws...)
 }
 
-// Post creates a POST route.
-func (m *Mux) Post(route string, h Handler) {
-	m.registerRoute(http.MethodPost, route, h)
+// isHealthRoute reports whether the method and route are those of a built-in health route.
+func isHealthRoute(method, route string) bool {
+	return method == healthzMethod && (route == healthzRoute || route == livezRoute || route == readyzRoute)
 }
 
-// Put creates a PUT route.
-func (m *Mux) Put(route string, h Handler) {
-	m.registerRoute(http.MethodPut, route, h)
+// isHealthReq reports whether the request targets a built-in health route, with a HEAD
+// request matching its GET route.
+func isHealthReq(r Request) bool {
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	return isHealthRoute(method, routeOf(r))
 }
 
-func (m *Mux) registerRoute(method, route string, h Handler) {
+func (m *Mux) registerRoute(method, route string, h Handler, mws ...Middleware) {
 	if route == "" {
 		panic("route must be provided")
 	}
 	if h == nil {
 		panic("handler must not be nil")
 	}
+	info := RouteInfo{Method: method, Route: route}
+	if typed, ok := h.(handlerOf); ok {
+		info.RequestType, info.ResponseType = typed.reqType, typed.respType
+	}
+	h = Chain(h, mws...)
 
-	isHealthZ := route == healthzRoute && method == healthzMethod
+	isHealthZ := isHealthRoute(method, route)
+
+	var pattern *routePattern
+	if isPatternRoute(route) {
+		p := parseRoutePattern(route)
+		pattern = &p
+		// patterns are keyed by their shape so that ambiguous patterns, differing only
+		// in parameter names, are caught by the duplicate check.
+		route = p.shape
+		h = withPathParams(p, h)
+	}
 
 	rk := routeKey{route: route, method: method}
 	if _, ok := m.handlers[rk]; ok && !isHealthZ {
+		if pattern != nil {
+			panic(fmt.Sprintf("ambiguous handlers added for: %q ", method+" "+pattern.route))
+		}
 		panic(fmt.Sprintf("multiple handlers added for: %q ", method+" "+route))
 	}
 
@@ -112,8 +274,14 @@ func (m *Mux) registerRoute(method, route string, h Handler) {
 		if m.handlers == nil {
 			m.handlers = map[routeKey]Handler{}
 		}
+		if m.infos == nil {
+			m.infos = map[routeKey]RouteInfo{}
+		}
 	}
 
+	if pattern != nil && !m.routes[route] {
+		m.addPattern(*pattern)
+	}
 	m.routes[route] = true
 
 	m2r := m.meth2Routes[method]
@@ -125,6 +293,50 @@ func (m *Mux) registerRoute(method, route string, h Handler) {
 	m.meth2Routes[method] = m2r
 
 	m.handlers[rk] = h
+	m.infos[rk] = info
+}
+
+// RouteInfo describes a route registered with the Mux. The request and response types
+// are set when the handler provides them, i.e. handlers created with HandleFnOf,
+// HandlerFnOfOK, or HandleWorkflowOf provide the request type and RespondsWith provides
+// the response type. Wrapping a handler in middleware before registering it hides its
+// types, middleware should be provided when registering the route instead.
+type RouteInfo struct {
+	Method       string
+	Route        string
+	RequestType  reflect.Type
+	ResponseType reflect.Type
+}
+
+// Routes returns the routes registered with the Mux, sorted by route and then method.
+func (m *Mux) Routes() []RouteInfo {
+	out := make([]RouteInfo, 0, len(m.infos))
+	for _, info := range m.infos {
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Route != out[j].Route {
+			return out[i].Route < out[j].Route
+		}
+		return out[i].Method < out[j].Method
+	})
+	return out
+}
+
+func (m *Mux) addPattern(p routePattern) {
+	i := sort.Search(len(m.patterns), func(i int) bool {
+		return p.morePrecise(m.patterns[i])
+	})
+	m.patterns = append(m.patterns, routePattern{})
+	copy(m.patterns[i+1:], m.patterns[i:])
+	m.patterns[i] = p
+}
+
+func routeOf(r Request) string {
+	if r.URL == "" {
+		return "/"
+	}
+	return r.URL
 }
 
 type routeKey struct {
@@ -0,0 +1,352 @@
+package fdk_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+func TestMux_patternRoutes(t *testing.T) {
+	newNamedHandler := func(name string) fdk.Handler {
+		return fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+			return fdk.Response{
+				Code: http.StatusOK,
+				Body: fdk.JSON(map[string]any{"handler": name, "params": fdk.PathParams(ctx)}),
+			}
+		})
+	}
+
+	mux := fdk.NewMux()
+	mux.Get("/people/me", newNamedHandler("me"))
+	mux.Get("/people/{id}", newNamedHandler("person"))
+	mux.Delete("/people/{name}", newNamedHandler("delete person"))
+	mux.Get("/people/{id}/notes/{noteID}", newNamedHandler("note"))
+	mux.Get("/files/{path...}", newNamedHandler("files"))
+	mux.Get("/files/{dir}/readme", newNamedHandler("readme"))
+
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		wantHandler string
+		wantParams  map[string]string
+		wantErr     *fdk.APIError
+	}{
+		{
+			name:        "static route takes precedence over parameter",
+			method:      http.MethodGet,
+			url:         "/people/me",
+			wantHandler: "me",
+		},
+		{
+			name:        "single parameter",
+			method:      http.MethodGet,
+			url:         "/people/frodo",
+			wantHandler: "person",
+			wantParams:  map[string]string{"id": "frodo"},
+		},
+		{
+			name:        "parameter name is per method",
+			method:      http.MethodDelete,
+			url:         "/people/frodo",
+			wantHandler: "delete person",
+			wantParams:  map[string]string{"name": "frodo"},
+		},
+		{
+			name:        "falls through to pattern when static route lacks the method",
+			method:      http.MethodDelete,
+			url:         "/people/me",
+			wantHandler: "delete person",
+			wantParams:  map[string]string{"name": "me"},
+		},
+		{
+			name:        "multiple parameters",
+			method:      http.MethodGet,
+			url:         "/people/frodo/notes/1",
+			wantHandler: "note",
+			wantParams:  map[string]string{"id": "frodo", "noteID": "1"},
+		},
+		{
+			name:        "wildcard matches remainder of path",
+			method:      http.MethodGet,
+			url:         "/files/a/b/c.txt",
+			wantHandler: "files",
+			wantParams:  map[string]string{"path": "a/b/c.txt"},
+		},
+		{
+			name:        "parameter takes precedence over wildcard",
+			method:      http.MethodGet,
+			url:         "/files/docs/readme",
+			wantHandler: "readme",
+			wantParams:  map[string]string{"dir": "docs"},
+		},
+		{
+			name:    "wildcard requires a segment after the prefix",
+			method:  http.MethodGet,
+			url:     "/files",
+			wantErr: &fdk.APIError{Code: http.StatusNotFound, Message: "route not found"},
+		},
+		{
+			name:    "wildcard requires a non empty segment after the prefix",
+			method:  http.MethodGet,
+			url:     "/files/",
+			wantErr: &fdk.APIError{Code: http.StatusNotFound, Message: "route not found"},
+		},
+		{
+			name:    "empty parameter segment is not found",
+			method:  http.MethodGet,
+			url:     "/people//notes/1",
+			wantErr: &fdk.APIError{Code: http.StatusNotFound, Message: "route not found"},
+		},
+		{
+			name:    "matching pattern without method is not allowed",
+			method:  http.MethodPost,
+			url:     "/people/frodo",
+			wantErr: &fdk.APIError{Code: http.StatusMethodNotAllowed, Message: "method not allowed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := mux.Handle(context.TODO(), fdk.Request{Method: tt.method, URL: tt.url})
+
+			if tt.wantErr != nil {
+				if !fdk.EqualVals(t, 1, len(resp.Errors)) {
+					return
+				}
+				fdk.EqualVals(t, *tt.wantErr, resp.Errors[0])
+				return
+			}
+
+			gotStatusOK(t, resp)
+
+			b, err := resp.Body.MarshalJSON()
+			mustNoErr(t, err)
+
+			var got struct {
+				Handler string            `json:"handler"`
+				Params  map[string]string `json:"params"`
+			}
+			decodeJSON(t, b, &got)
+
+			fdk.EqualVals(t, tt.wantHandler, got.Handler)
+			fdk.EqualVals(t, len(tt.wantParams), len(got.Params))
+			for k, v := range tt.wantParams {
+				fdk.EqualVals(t, v, got.Params[k], "param: %s", k)
+			}
+		})
+	}
+}
+
+func TestMux_patternRoutesPanics(t *testing.T) {
+	noop := fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+		return fdk.Response{}
+	})
+
+	tests := []struct {
+		name      string
+		register  func(m *fdk.Mux)
+		wantPanic string
+	}{
+		{
+			name: "ambiguous parameter names",
+			register: func(m *fdk.Mux) {
+				m.Get("/people/{id}", noop)
+				m.Get("/people/{name}", noop)
+			},
+			wantPanic: `ambiguous handlers added for: "GET /people/{name}" `,
+		},
+		{
+			name: "wildcard not final segment",
+			register: func(m *fdk.Mux) {
+				m.Get("/files/{path...}/foo", noop)
+			},
+			wantPanic: `route wildcard must be the final path segment: "/files/{path...}/foo"`,
+		},
+		{
+			name: "partial segment parameter",
+			register: func(m *fdk.Mux) {
+				m.Get("/files/id-{id}", noop)
+			},
+			wantPanic: `route parameter must make up an entire path segment: "/files/id-{id}"`,
+		},
+		{
+			name: "unnamed parameter",
+			register: func(m *fdk.Mux) {
+				m.Get("/files/{}", noop)
+			},
+			wantPanic: `route parameter must be named: "/files/{}"`,
+		},
+		{
+			name: "duplicate parameter name",
+			register: func(m *fdk.Mux) {
+				m.Get("/files/{id}/{id}", noop)
+			},
+			wantPanic: `duplicate route parameter "id" in route: "/files/{id}/{id}"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				got, _ := recover().(string)
+				fdk.EqualVals(t, tt.wantPanic, got)
+			}()
+
+			tt.register(fdk.NewMux())
+		})
+	}
+}
+
+func TestMux_methods(t *testing.T) {
+	newMethodHandler := func(method string) fdk.Handler {
+		return fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+			return fdk.Response{
+				Code:   http.StatusOK,
+				Body:   fdk.JSON(map[string]string{"method": method}),
+				Header: http.Header{"X-Fn-Method": []string{method}},
+			}
+		})
+	}
+
+	mux := fdk.NewMux()
+	mux.Get("/things", newMethodHandler(http.MethodGet))
+	mux.Patch("/things", newMethodHandler(http.MethodPatch))
+	mux.Post("/things", newMethodHandler(http.MethodPost))
+	mux.Delete("/things/{id}", newMethodHandler(http.MethodDelete))
+
+	t.Run("PATCH route should dispatch", func(t *testing.T) {
+		resp := mux.Handle(context.TODO(), fdk.Request{Method: http.MethodPatch, URL: "/things"})
+		gotStatusOK(t, resp)
+		fdk.EqualVals(t, http.MethodPatch, resp.Header.Get("X-Fn-Method"))
+	})
+
+	t.Run("HEAD should dispatch to GET route and strip the body", func(t *testing.T) {
+		resp := mux.Handle(context.TODO(), fdk.Request{Method: http.MethodHead, URL: "/things"})
+		fdk.EqualVals(t, http.StatusOK, resp.StatusCode())
+		fdk.EqualVals(t, http.MethodGet, resp.Header.Get("X-Fn-Method"))
+		fdk.EqualVals(t, true, resp.Body == nil)
+	})
+
+	t.Run("HEAD without a GET route is not allowed", func(t *testing.T) {
+		resp := mux.Handle(context.TODO(), fdk.Request{Method: http.MethodHead, URL: "/things/1"})
+		fdk.EqualVals(t, http.StatusMethodNotAllowed, resp.StatusCode())
+		fdk.EqualVals(t, "DELETE, OPTIONS", resp.Header.Get("Allow"))
+	})
+
+	t.Run("OPTIONS should list the allowed methods", func(t *testing.T) {
+		resp := mux.Handle(context.TODO(), fdk.Request{Method: http.MethodOptions, URL: "/things"})
+		fdk.EqualVals(t, http.StatusNoContent, resp.StatusCode())
+		fdk.EqualVals(t, 0, len(resp.Errors))
+		fdk.EqualVals(t, "GET, HEAD, OPTIONS, PATCH, POST", resp.Header.Get("Allow"))
+	})
+
+	t.Run("OPTIONS on an unknown route is not found", func(t *testing.T) {
+		resp := mux.Handle(context.TODO(), fdk.Request{Method: http.MethodOptions, URL: "/nope"})
+		fdk.EqualVals(t, http.StatusNotFound, resp.StatusCode())
+	})
+
+	t.Run("method not allowed should set the Allow header", func(t *testing.T) {
+		resp := mux.Handle(context.TODO(), fdk.Request{Method: http.MethodPut, URL: "/things"})
+		fdk.EqualVals(t, http.StatusMethodNotAllowed, resp.StatusCode())
+		fdk.EqualVals(t, "GET, HEAD, OPTIONS, PATCH, POST", resp.Header.Get("Allow"))
+	})
+}
+
+func TestMux_middleware(t *testing.T) {
+	// recordMW appends the name to the X-Order header on the way out, so the
+	// innermost middleware is recorded first.
+	recordMW := func(name string) fdk.Middleware {
+		return func(next fdk.Handler) fdk.Handler {
+			return fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+				resp := next.Handle(ctx, r)
+				if resp.Header == nil {
+					resp.Header = make(http.Header)
+				}
+				resp.Header.Add("X-Order", name)
+				return resp
+			})
+		}
+	}
+	okHandler := fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+		return fdk.Response{Code: http.StatusOK}
+	})
+
+	mux := fdk.NewMux()
+	mux.Use(recordMW("global1"), recordMW("global2"))
+	mux.Get("/route", okHandler, recordMW("route"))
+
+	api := mux.Group("/api/", recordMW("api"))
+	api.Get("/people/{id}", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+		return fdk.Response{Code: http.StatusOK, Header: http.Header{"X-Id": []string{fdk.PathParam(ctx, "id")}}}
+	}), recordMW("route"))
+
+	v2 := api.Group("/v2", recordMW("v2"))
+	v2.Post("/things", okHandler)
+
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		wantCode  int
+		wantOrder []string
+	}{
+		{
+			name:      "route middleware is applied within global middleware",
+			method:    http.MethodGet,
+			url:       "/route",
+			wantCode:  http.StatusOK,
+			wantOrder: []string{"route", "global2", "global1"},
+		},
+		{
+			name:      "group middleware is applied between global and route middleware",
+			method:    http.MethodGet,
+			url:       "/api/people/1",
+			wantCode:  http.StatusOK,
+			wantOrder: []string{"route", "api", "global2", "global1"},
+		},
+		{
+			name:      "nested group middleware is applied within parent group middleware",
+			method:    http.MethodPost,
+			url:       "/api/v2/things",
+			wantCode:  http.StatusOK,
+			wantOrder: []string{"v2", "api", "global2", "global1"},
+		},
+		{
+			name:      "global middleware applies to healthz",
+			method:    http.MethodGet,
+			url:       "/healthz",
+			wantCode:  http.StatusOK,
+			wantOrder: []string{"global2", "global1"},
+		},
+		{
+			name:      "global middleware applies to not found",
+			method:    http.MethodGet,
+			url:       "/nope",
+			wantCode:  http.StatusNotFound,
+			wantOrder: []string{"global2", "global1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := mux.Handle(context.TODO(), fdk.Request{Method: tt.method, URL: tt.url})
+			fdk.EqualVals(t, tt.wantCode, resp.StatusCode())
+
+			gotOrder := resp.Header.Values("X-Order")
+			if !fdk.EqualVals(t, len(tt.wantOrder), len(gotOrder)) {
+				return
+			}
+			for i, want := range tt.wantOrder {
+				fdk.EqualVals(t, want, gotOrder[i])
+			}
+		})
+	}
+
+	t.Run("path params are available to route middleware", func(t *testing.T) {
+		resp := mux.Handle(context.TODO(), fdk.Request{Method: http.MethodGet, URL: "/api/people/frodo"})
+		fdk.EqualVals(t, "frodo", resp.Header.Get("X-Id"))
+	})
+}
@@ -0,0 +1,171 @@
+package fdk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/CrowdStrike/foundry-fn-go/jsonschema"
+)
+
+// OpenAPIInfo provides the info object of the generated OpenAPI document.
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPI generates an OpenAPI 3.1 document describing the routes registered with the
+// Mux. The request and response bodies are described by JSON Schemas derived from the
+// Go types carried by each route (see RouteInfo). A trailing wildcard is described as a
+// path parameter, as OpenAPI has no notion of a wildcard. The built-in health routes are
+// left out of the document.
+func (m *Mux) OpenAPI(info OpenAPIInfo) ([]byte, error) {
+	r := jsonschema.NewReflector("#/components/schemas/")
+
+	paths := make(map[string]map[string]openAPIOperation)
+	opIDs := make(map[string]int)
+	for _, route := range m.Routes() {
+		if isHealthRoute(route.Method, route.Route) {
+			continue
+		}
+		path, params := openAPIPath(route.Route)
+
+		// routes differing only in punctuation or parameter braces share an ID, the later
+		// ones are suffixed with a count to keep the IDs unique
+		opID := openAPIOperationID(route.Method, path)
+		opIDs[opID]++
+		if n := opIDs[opID]; n > 1 {
+			opID += strconv.Itoa(n)
+		}
+
+		op := openAPIOperation{
+			OperationID: opID,
+			Parameters:  params,
+			Responses:   map[string]openAPIResponse{},
+		}
+		if route.RequestType != nil {
+			op.RequestBody = &openAPIRequestBody{
+				Required: true,
+				Content:  openAPIContent(r.Reflect(route.RequestType)),
+			}
+		}
+
+		resp := openAPIResponse{Description: "successful response"}
+		if route.ResponseType != nil {
+			resp.Content = openAPIContent(r.Reflect(route.ResponseType))
+		}
+		op.Responses["200"] = resp
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]openAPIOperation)
+		}
+		paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	doc := struct {
+		OpenAPI    string                                 `json:"openapi"`
+		Info       OpenAPIInfo                            `json:"info"`
+		Paths      map[string]map[string]openAPIOperation `json:"paths"`
+		Components struct {
+			Schemas map[string]*jsonschema.Schema `json:"schemas,omitempty"`
+		} `json:"components"`
+	}{
+		OpenAPI: "3.1.0",
+		Info:    info,
+		Paths:   paths,
+	}
+	doc.Components.Schemas = r.Defs()
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// OpenAPIHandler creates a handler that responds with the OpenAPI document of the Mux.
+// This is useful for serving the document from a debug route.
+func (m *Mux) OpenAPIHandler(info OpenAPIInfo) Handler {
+	return HandlerFn(func(ctx context.Context, r Request) Response {
+		b, err := m.OpenAPI(info)
+		if err != nil {
+			return ErrResp(APIError{Code: http.StatusInternalServerError, Message: "failed to generate OpenAPI document: " + err.Error()})
+		}
+		return Response{Code: http.StatusOK, Body: json.RawMessage(b)}
+	})
+}
+
+type (
+	openAPIOperation struct {
+		OperationID string                     `json:"operationId"`
+		Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+		RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+		Responses   map[string]openAPIResponse `json:"responses"`
+	}
+
+	openAPIParameter struct {
+		Name     string             `json:"name"`
+		In       string             `json:"in"`
+		Required bool               `json:"required"`
+		Schema   *jsonschema.Schema `json:"schema"`
+	}
+
+	openAPIRequestBody struct {
+		Required bool                        `json:"required"`
+		Content  map[string]openAPIMediaType `json:"content"`
+	}
+
+	openAPIResponse struct {
+		Description string                      `json:"description"`
+		Content     map[string]openAPIMediaType `json:"content,omitempty"`
+	}
+
+	openAPIMediaType struct {
+		Schema *jsonschema.Schema `json:"schema"`
+	}
+)
+
+func openAPIContent(s *jsonschema.Schema) map[string]openAPIMediaType {
+	return map[string]openAPIMediaType{"application/json": {Schema: s}}
+}
+
+// openAPIOperationID derives an identifier safe operation ID from the method and path,
+// i.e. getPeopleId for GET /people/{id}.
+func openAPIOperationID(method, path string) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(method))
+	words := strings.FieldsFunc(path, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		runes := []rune(w)
+		sb.WriteRune(unicode.ToUpper(runes[0]))
+		sb.WriteString(string(runes[1:]))
+	}
+	return sb.String()
+}
+
+// openAPIPath converts a route to its OpenAPI path and path parameters.
+func openAPIPath(route string) (string, []openAPIParameter) {
+	if !isPatternRoute(route) {
+		return route, nil
+	}
+
+	p := parseRoutePattern(route)
+	parts := make([]string, 0, len(p.segments))
+	var params []openAPIParameter
+	for _, seg := range p.segments {
+		if seg.kind == segmentLiteral {
+			parts = append(parts, seg.val)
+			continue
+		}
+		parts = append(parts, "{"+seg.val+"}")
+		params = append(params, openAPIParameter{
+			Name:     seg.val,
+			In:       "path",
+			Required: true,
+			Schema:   &jsonschema.Schema{Type: "string"},
+		})
+	}
+	return strings.Join(parts, "/"), params
+}
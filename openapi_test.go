@@ -0,0 +1,174 @@
+package fdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+type (
+	openAPIPersonReq struct {
+		Name string `json:"name"`
+		Age  int    `json:"age,omitempty"`
+	}
+
+	openAPIPersonResp struct {
+		ID     string           `json:"id"`
+		Person openAPIPersonReq `json:"person"`
+	}
+)
+
+func newOpenAPIMux() *fdk.Mux {
+	noop := func(ctx context.Context, r fdk.RequestOf[openAPIPersonReq]) fdk.Response {
+		return fdk.Response{}
+	}
+
+	mux := fdk.NewMux()
+	mux.Post("/people", fdk.RespondsWith[openAPIPersonResp](fdk.HandleFnOf(noop)))
+	mux.Get("/people/{id}", fdk.RespondsWith[openAPIPersonResp](fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+		return fdk.Response{}
+	})))
+	mux.Put("/people/{id}", fdk.HandleWorkflowOf(func(ctx context.Context, r fdk.RequestOf[openAPIPersonReq], _ fdk.WorkflowCtx) fdk.Response {
+		return fdk.Response{}
+	}))
+	mux.Get("/files/{path...}", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+		return fdk.Response{}
+	}))
+	return mux
+}
+
+func TestMux_Routes(t *testing.T) {
+	got := newOpenAPIMux().Routes()
+
+	reqType := reflect.TypeOf(openAPIPersonReq{})
+	respType := reflect.TypeOf(openAPIPersonResp{})
+	want := []fdk.RouteInfo{
+		{Method: http.MethodGet, Route: "/files/{path...}"},
+		{Method: http.MethodGet, Route: "/healthz"},
+		{Method: http.MethodGet, Route: "/livez"},
+		{Method: http.MethodPost, Route: "/people", RequestType: reqType, ResponseType: respType},
+		{Method: http.MethodGet, Route: "/people/{id}", ResponseType: respType},
+		{Method: http.MethodPut, Route: "/people/{id}", RequestType: reqType},
+		{Method: http.MethodGet, Route: "/readyz"},
+	}
+	if !fdk.EqualVals(t, len(want), len(got)) {
+		return
+	}
+	for i, w := range want {
+		fdk.EqualVals(t, w, got[i], "route: %d", i)
+	}
+}
+
+func TestMux_OpenAPI(t *testing.T) {
+	mux := newOpenAPIMux()
+
+	b, err := mux.OpenAPI(fdk.OpenAPIInfo{Title: "people", Version: "1.0.0"})
+	mustNoErr(t, err)
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title   string `json:"title"`
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Parameters  []struct {
+				Name     string `json:"name"`
+				In       string `json:"in"`
+				Required bool   `json:"required"`
+			} `json:"parameters"`
+			RequestBody *struct {
+				Content map[string]struct {
+					Schema struct {
+						Ref string `json:"$ref"`
+					} `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+			Responses map[string]struct {
+				Content map[string]struct {
+					Schema struct {
+						Ref string `json:"$ref"`
+					} `json:"schema"`
+				} `json:"content"`
+			} `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Type       string                     `json:"type"`
+				Properties map[string]json.RawMessage `json:"properties"`
+				Required   []string                   `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	decodeJSON(t, b, &doc)
+
+	fdk.EqualVals(t, "3.1.0", doc.OpenAPI)
+	fdk.EqualVals(t, "people", doc.Info.Title)
+	fdk.EqualVals(t, "1.0.0", doc.Info.Version)
+
+	fdk.EqualVals(t, 3, len(doc.Paths))
+	for _, route := range []string{"/healthz", "/livez", "/readyz"} {
+		_, ok := doc.Paths[route]
+		fdk.EqualVals(t, false, ok, "route: %s", route)
+	}
+
+	wantOpIDs := map[string]string{
+		"post /people":      "postPeople",
+		"get /people/{id}":  "getPeopleId",
+		"put /people/{id}":  "putPeopleId",
+		"get /files/{path}": "getFilesPath",
+	}
+	for k, want := range wantOpIDs {
+		method, path, _ := strings.Cut(k, " ")
+		fdk.EqualVals(t, want, doc.Paths[path][method].OperationID, "operation: %s", k)
+	}
+
+	post := doc.Paths["/people"]["post"]
+	if post.RequestBody == nil {
+		t.Fatal("expected a request body for POST /people")
+	}
+	fdk.EqualVals(t, "#/components/schemas/openAPIPersonReq", post.RequestBody.Content["application/json"].Schema.Ref)
+	fdk.EqualVals(t, "#/components/schemas/openAPIPersonResp", post.Responses["200"].Content["application/json"].Schema.Ref)
+
+	get := doc.Paths["/people/{id}"]["get"]
+	if fdk.EqualVals(t, 1, len(get.Parameters)) {
+		fdk.EqualVals(t, "id", get.Parameters[0].Name)
+		fdk.EqualVals(t, "path", get.Parameters[0].In)
+		fdk.EqualVals(t, true, get.Parameters[0].Required)
+	}
+	fdk.EqualVals(t, true, get.RequestBody == nil)
+
+	files := doc.Paths["/files/{path}"]["get"]
+	if fdk.EqualVals(t, 1, len(files.Parameters)) {
+		fdk.EqualVals(t, "path", files.Parameters[0].Name)
+	}
+
+	reqSchema := doc.Components.Schemas["openAPIPersonReq"]
+	fdk.EqualVals(t, "object", reqSchema.Type)
+	fdk.EqualVals(t, 2, len(reqSchema.Properties))
+	if fdk.EqualVals(t, 1, len(reqSchema.Required)) {
+		fdk.EqualVals(t, "name", reqSchema.Required[0])
+	}
+
+	t.Run("served from a debug route", func(t *testing.T) {
+		mux.Get("/debug/openapi", mux.OpenAPIHandler(fdk.OpenAPIInfo{Title: "people", Version: "1.0.0"}))
+
+		resp := mux.Handle(context.TODO(), fdk.Request{Method: http.MethodGet, URL: "/debug/openapi"})
+		gotStatusOK(t, resp)
+
+		served, err := resp.Body.MarshalJSON()
+		mustNoErr(t, err)
+
+		var servedDoc struct {
+			Paths map[string]json.RawMessage `json:"paths"`
+		}
+		decodeJSON(t, served, &servedDoc)
+		fdk.EqualVals(t, 4, len(servedDoc.Paths))
+	})
+}
@@ -0,0 +1,47 @@
+package fdk
+
+import (
+	"context"
+	"log/slog"
+)
+
+type (
+	ctxKeyTraceID struct{}
+	ctxKeyLogger  struct{}
+)
+
+// TraceIDFrom returns the trace ID of the request being handled, or an empty string
+// when none is available.
+func TraceIDFrom(ctx context.Context) string {
+	traceID, _ := ctx.Value(ctxKeyTraceID{}).(string)
+	return traceID
+}
+
+// LoggerFrom returns the request scoped logger. The logger is pre-populated with the
+// trace ID, fn ID, fn version, and method of the request, and the route matched by the
+// Mux. When no logger is available, the default logger is returned.
+func LoggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(ctxKeyLogger{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func withTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, ctxKeyTraceID{}, traceID)
+}
+
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKeyLogger{}, logger)
+}
+
+// withRequestScope adds the trace ID and the request scoped logger to the context.
+func withRequestScope(ctx context.Context, logger *slog.Logger, r Request) context.Context {
+	ctx = withTraceID(ctx, r.TraceID)
+	return withLogger(ctx, logger.With(
+		"trace_id", r.TraceID,
+		"fn_id", r.FnID,
+		"fn_version", r.FnVersion,
+		"method", r.Method,
+	))
+}
@@ -0,0 +1,44 @@
+package fdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"testing"
+)
+
+func TestRequestScope(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	var gotTraceID string
+	mux := NewMux()
+	mux.Get("/people/{id}", HandlerFn(func(ctx context.Context, r Request) Response {
+		gotTraceID = TraceIDFrom(ctx)
+		LoggerFrom(ctx).Info("handling request")
+		return Response{Code: http.StatusOK}
+	}))
+
+	envelope := `{"fn_id":"fn1","fn_version":3,"method":"GET","url":"/people/frodo","trace_id":"trace1"}`
+	_, err := dispatchEnvelope(context.Background(), logger, dispatchReq(logger, mux), []byte(envelope))
+	mustNoErrInternal(t, err)
+
+	EqualVals(t, "trace1", gotTraceID)
+
+	var got map[string]any
+	mustNoErrInternal(t, json.Unmarshal(logs.Bytes(), &got))
+
+	EqualVals[any](t, "handling request", got["msg"])
+	EqualVals[any](t, "trace1", got["trace_id"])
+	EqualVals[any](t, "fn1", got["fn_id"])
+	EqualVals[any](t, float64(3), got["fn_version"])
+	EqualVals[any](t, http.MethodGet, got["method"])
+	EqualVals[any](t, "/people/{id}", got["route"])
+}
+
+func TestRequestScope_defaults(t *testing.T) {
+	EqualVals(t, "", TraceIDFrom(context.Background()))
+	EqualVals(t, slog.Default(), LoggerFrom(context.Background()))
+}
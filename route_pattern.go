@@ -0,0 +1,144 @@
+package fdk
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type segmentKind int
+
+const (
+	segmentLiteral segmentKind = iota
+	segmentParam
+	segmentWildcard
+)
+
+type routeSegment struct {
+	kind segmentKind
+	val  string // literal value or parameter name
+}
+
+// routePattern is a route containing named parameters, i.e. /people/{id}, and optionally a
+// trailing wildcard, i.e. /files/{path...}.
+type routePattern struct {
+	route    string
+	shape    string
+	segments []routeSegment
+}
+
+func isPatternRoute(route string) bool {
+	return strings.ContainsAny(route, "{}")
+}
+
+func parseRoutePattern(route string) routePattern {
+	parts := strings.Split(route, "/")
+
+	p := routePattern{route: route, segments: make([]routeSegment, 0, len(parts))}
+	shapeParts := make([]string, 0, len(parts))
+	seen := make(map[string]bool)
+	for i, part := range parts {
+		if !strings.ContainsAny(part, "{}") {
+			p.segments = append(p.segments, routeSegment{kind: segmentLiteral, val: part})
+			shapeParts = append(shapeParts, part)
+			continue
+		}
+
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") || strings.Count(part, "{") != 1 || strings.Count(part, "}") != 1 {
+			panic(fmt.Sprintf("route parameter must make up an entire path segment: %q", route))
+		}
+
+		seg, shape := routeSegment{kind: segmentParam, val: part[1 : len(part)-1]}, "{}"
+		if name, ok := strings.CutSuffix(seg.val, "..."); ok {
+			if i != len(parts)-1 {
+				panic(fmt.Sprintf("route wildcard must be the final path segment: %q", route))
+			}
+			seg, shape = routeSegment{kind: segmentWildcard, val: name}, "{...}"
+		}
+
+		if seg.val == "" {
+			panic(fmt.Sprintf("route parameter must be named: %q", route))
+		}
+		if seen[seg.val] {
+			panic(fmt.Sprintf("duplicate route parameter %q in route: %q", seg.val, route))
+		}
+		seen[seg.val] = true
+
+		p.segments = append(p.segments, seg)
+		shapeParts = append(shapeParts, shape)
+	}
+	p.shape = strings.Join(shapeParts, "/")
+
+	return p
+}
+
+// match reports whether the route matches the pattern, and if so, the path parameters.
+func (p routePattern) match(route string) (map[string]string, bool) {
+	parts := strings.Split(route, "/")
+
+	params := make(map[string]string)
+	for i, seg := range p.segments {
+		if seg.kind == segmentWildcard {
+			// the wildcard matches one or more segments, the bare prefix is not matched
+			path := strings.Join(parts[i:], "/")
+			if path == "" {
+				return nil, false
+			}
+			params[seg.val] = path
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+
+		switch seg.kind {
+		case segmentLiteral:
+			if parts[i] != seg.val {
+				return nil, false
+			}
+		case segmentParam:
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[seg.val] = parts[i]
+		}
+	}
+	if len(parts) != len(p.segments) {
+		return nil, false
+	}
+
+	return params, true
+}
+
+// morePrecise reports whether the pattern takes precedence over the other. Comparing
+// segments from left to right, the first literal beats a parameter, which beats a
+// wildcard. When one pattern is a prefix of the other, the shorter pattern wins.
+func (p routePattern) morePrecise(other routePattern) bool {
+	for i := 0; i < len(p.segments) && i < len(other.segments); i++ {
+		if a, b := p.segments[i].kind, other.segments[i].kind; a != b {
+			return a < b
+		}
+	}
+	return len(p.segments) < len(other.segments)
+}
+
+type ctxKeyPathParams struct{}
+
+// PathParam returns the named path parameter matched by a Mux pattern route. When no
+// parameter by that name exists, an empty string is returned.
+func PathParam(ctx context.Context, name string) string {
+	return PathParams(ctx)[name]
+}
+
+// PathParams returns all path parameters matched by a Mux pattern route, keyed by name.
+func PathParams(ctx context.Context) map[string]string {
+	params, _ := ctx.Value(ctxKeyPathParams{}).(map[string]string)
+	return params
+}
+
+func withPathParams(p routePattern, h Handler) Handler {
+	return HandlerFn(func(ctx context.Context, r Request) Response {
+		params, _ := p.match(routeOf(r))
+		return h.Handle(context.WithValue(ctx, ctxKeyPathParams{}, params), r)
+	})
+}
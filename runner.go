@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"sync/atomic"
 )
 
 // Runner defines the runtime that executes the request/response handler lifecycle.
@@ -33,6 +34,25 @@ func run(ctx context.Context, newHandlerFn func(context.Context, *slog.Logger) H
 	r(ctx, newHandlerFn)
 }
 
+type ctxKeyExitCode struct{}
+
+// withExitCode makes the exit code of the process available to the runners, which set
+// it via setExitCode.
+func withExitCode(ctx context.Context) (context.Context, *atomic.Int32) {
+	code := new(atomic.Int32)
+	return context.WithValue(ctx, ctxKeyExitCode{}, code), code
+}
+
+// setExitCode sets the status the process exits with once Run has run the shutdown
+// hooks, so that a runner reports a failure without skipping them.
+func setExitCode(ctx context.Context, code int) {
+	if c, ok := ctx.Value(ctxKeyExitCode{}).(*atomic.Int32); ok {
+		c.Store(int32(code))
+	}
+}
+
 var runners = map[string]func(ctx context.Context, newHandlerFn func(context.Context, *slog.Logger) Handler){
-	"http": runHTTP,
+	"http":   runHTTP,
+	"jsonl":  runJSONL,
+	"replay": runReplay,
 }
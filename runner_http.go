@@ -10,13 +10,18 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"mime/multipart"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -26,41 +31,154 @@ const (
 )
 
 func runHTTP(ctx context.Context, newHandlerFn func(context.Context, *slog.Logger) Handler) {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{AddSource: true}))
+	o := runOptsFrom(ctx)
+	logger := newRunnerLogger(o, os.Stdout)
+	cfg, err := httpServerCfg(o.httpServer)
+	if err != nil {
+		panic(err.Error())
+	}
+	mCfg, err := metricsCfg(o.metrics)
+	if err != nil {
+		panic(err.Error())
+	}
+	o.unixSocket, o.unixSocketMode, err = unixSocketCfg(o)
+	if err != nil {
+		panic(err.Error())
+	}
 
-	handler := newHandlerFn(ctx, logger)
+	drain := newDrainer()
+	handler := drain.track(newHandlerFn(ctx, logger))
 
 	mux := http.NewServeMux()
-	mux.Handle("/", dispatchReq(logger, handler))
+	limiter := newConcurrencyLimiter(cfg)
+	mux.Handle("/", limitConcurrency(logger, limiter, limitBody(cfg.MaxBodyBytes, dispatchReq(logger, handler))))
+
+	switch {
+	case mCfg.Addr != "":
+		stopMetrics, err := serveMetrics(logger, mCfg, MetricsFrom(ctx))
+		if err != nil {
+			logger.Error("failed to serve metrics", "err", err)
+			return
+		}
+		defer stopMetrics()
+	case mCfg.Route != "":
+		mux.Handle(mCfg.Route, MetricsFrom(ctx))
+	}
+
+	l, err := httpListener(o)
+	if err != nil {
+		logger.Error("failed to listen", "err", err)
+		return
+	}
 
 	s := &http.Server{
-		Addr:           fmt.Sprintf(":%d", port()),
-		Handler:        mux,
-		MaxHeaderBytes: mb,
+		Handler:           mux,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		// requests carry the run options, i.e. the tracer provider, but are not cancelled
+		// along with the ctx, the drain decides when they are cut off
+		BaseContext: func(net.Listener) context.Context { return context.WithoutCancel(ctx) },
 	}
+	shutdownDone := make(chan struct{})
 	go func() {
-		select {
-		case <-ctx.Done():
-			shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-			defer cancel()
+		defer close(shutdownDone)
+		<-ctx.Done()
+		drain.shutdown(logger, s, cfg)
+	}()
+
+	logger.Info("serving HTTP server on " + l.Addr().Network() + " " + l.Addr().String())
+	err = s.Serve(l)
+	if !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("unexpected shutdown of server", "err", err)
+		return
+	}
+	// serving stops as soon as the shutdown starts, the requests in flight are waited on
+	<-shutdownDone
+}
+
+// httpListener creates the listener for the HTTP runner. In order of precedence, this
+// is the injected listener, the Unix socket, or the TCP port.
+func httpListener(o runOpts) (net.Listener, error) {
+	if o.listener != nil {
+		return o.listener, nil
+	}
 
-			logger.Info("shutting down HTTP server...")
-			if err := s.Shutdown(shutdownCtx); err != nil {
-				logger.Error("failed to shutdown server", "err", err)
+	socket, mode := o.unixSocket, o.unixSocketMode
+	if socket == "" {
+		return net.Listen("tcp", fmt.Sprintf(":%d", port()))
+	}
+
+	if err := removeStaleSocket(socket); err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, mode.Perm()); err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("failed to set unix socket permissions: %w", err)
+	}
+	return l, nil
+}
+
+// unixSocketCfg returns the Unix socket the HTTP runner listens on, if any, and its
+// permissions. The socket set via WithUnixSocket takes precedence over the env vars.
+func unixSocketCfg(o runOpts) (string, os.FileMode, error) {
+	socket, mode := o.unixSocket, o.unixSocketMode
+	if socket == "" {
+		socket = os.Getenv("CS_HTTP_UNIX_SOCKET")
+		if v := os.Getenv("CS_HTTP_UNIX_SOCKET_MODE"); v != "" {
+			m, err := strconv.ParseUint(v, 8, 32)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid CS_HTTP_UNIX_SOCKET_MODE provided: %q", v)
 			}
+			mode = os.FileMode(m)
 		}
-	}()
+	}
+	if mode == 0 {
+		mode = 0660
+	}
+	return socket, mode, nil
+}
 
-	logger.Info("serving HTTP server on port " + strconv.Itoa(port()))
-	if err := s.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		logger.Error("unexpected shutdown of server", "err", err)
+// removeStaleSocket removes a socket file that no process is listening on. Files that
+// are not sockets, or sockets still in use, are left untouched.
+func removeStaleSocket(socket string) error {
+	fi, err := os.Lstat(socket)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat unix socket: %w", err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("unix socket path exists and is not a socket: %s", socket)
+	}
+
+	conn, err := net.DialTimeout("unix", socket, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("unix socket is in use by another process: %s", socket)
+	}
+
+	if err := os.Remove(socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale unix socket: %w", err)
 	}
+	return nil
 }
 
 func dispatchReq(logger *slog.Logger, handler Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		obs := newInvocationObserver(logger, w, req)
+		w = obs
+
 		defer func() {
-			if n, err := io.Copy(io.Discard, req.Body); err != nil {
+			if n, err := io.Copy(io.Discard, req.Body); err != nil && !errors.As(err, new(*http.MaxBytesError)) {
 				logger.Error("failed to drain request body", "err", err.Error(), "bytes_drained", n)
 			}
 			if err := req.Body.Close(); err != nil {
@@ -68,7 +186,7 @@ func dispatchReq(logger *slog.Logger, handler Handler) http.Handler {
 			}
 		}()
 
-		r, closeFn, err := toRequest(req)
+		r, deadline, closeFn, err := toRequest(req)
 		if err != nil {
 			defer func() {
 				if closeFn == nil {
@@ -78,11 +196,19 @@ func dispatchReq(logger *slog.Logger, handler Handler) http.Handler {
 					logger.Error("failed to close request body", "err", err.Error())
 				}
 			}()
-			logger.Error("failed to create request", "err", err)
-			writeErr := writeResponse(logger, w, ErrResp(APIError{Code: http.StatusInternalServerError, Message: "unable to process incoming request"}))
+			apiErr := APIError{Code: http.StatusInternalServerError, Message: "unable to process incoming request"}
+			if envErr := new(envelopeErr); errors.As(err, &envErr) {
+				apiErr = envErr.apiErr
+			}
+			logger.Error("failed to create request", "err", err, "status_code", apiErr.Code)
+			_, span := startInvokeSpan(req.Context(), Request{})
+			span.RecordError(err)
+			endInvokeSpan(span, ErrResp(apiErr))
+			writeErr := writeResponse(logger, w, ErrResp(apiErr))
 			if writeErr != nil {
 				logger.Error("failed to write failed request response", "err", writeErr)
 			}
+			obs.observe(Request{}, ErrResp(apiErr))
 			return
 		}
 		defer func() {
@@ -91,14 +217,39 @@ func dispatchReq(logger *slog.Logger, handler Handler) http.Handler {
 			}
 		}()
 
-		const ctxKeyTraceID = "_traceid"
-		ctx := context.WithValue(req.Context(), ctxKeyTraceID, r.TraceID)
+		ctx, span := startInvokeSpan(req.Context(), r)
+
+		release, shedResp, ok := limitRequest(ctx, logger, w, r)
+		if !ok {
+			endInvokeSpan(span, shedResp)
+			obs.observe(r, shedResp)
+			return
+		}
+		defer release()
+
+		ctx = withRequestScope(ctx, logger, r)
+		ctx = withInvocationObserver(ctx, obs)
+		if !deadline.IsZero() {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
 
 		resp := handler.Handle(ctx, r)
+		defer func() {
+			obs.observe(r, resp)
+			endInvokeSpan(span, resp)
+		}()
 
 		if f, ok := resp.Body.(File); ok {
 			f = NormalizeFile(f)
+			_, fileSpan := startSpan(ctx, "fn.file.write", trace.WithAttributes(attribute.String("file.name", f.Filename)))
 			sha256Hash, size, err := writeFile(logger, f.Contents, f.Filename)
+			fileSpan.SetAttributes(attribute.Int("file.size", size))
+			endSpan(fileSpan, err)
+			if err == nil {
+				obs.fileSize = size
+			}
 			if err != nil {
 				resp.Errors = append(resp.Errors, APIError{Code: http.StatusInternalServerError, Message: err.Error()})
 				writeErr := writeResponse(logger, w, resp)
@@ -112,13 +263,7 @@ func dispatchReq(logger *slog.Logger, handler Handler) http.Handler {
 			// possible without having the runner do it. We can maintain streaming semantics while also
 			// obtaining our sha/size by extending the writer to support this when we're moving the
 			// contents to disk (or w/e sync we use)
-			respBody := struct {
-				ContentType string `json:"content_type"`
-				Encoding    string `json:"encoding"`
-				Filename    string `json:"filename"`
-				SHA256      string `json:"sha256_checksum"`
-				Size        int    `json:"size,string"`
-			}{
+			respBody := fileRespBody{
 				ContentType: f.ContentType,
 				Encoding:    f.Encoding,
 				Filename:    f.Filename,
@@ -135,15 +280,69 @@ func dispatchReq(logger *slog.Logger, handler Handler) http.Handler {
 	})
 }
 
-func toRequest(req *http.Request) (Request, func() error, error) {
+// fileRespBody is the response body written in place of a File.
+type fileRespBody struct {
+	ContentType string `json:"content_type"`
+	Encoding    string `json:"encoding"`
+	Filename    string `json:"filename"`
+	SHA256      string `json:"sha256_checksum"`
+	Size        int    `json:"size,string"`
+}
+
+// envelopeErr classifies a failure to read the request envelope. The apiErr is safe
+// to share with the caller, while the underlying err is only logged.
+type envelopeErr struct {
+	err    error
+	apiErr APIError
+}
+
+func (e *envelopeErr) Error() string {
+	return e.err.Error()
+}
+
+func (e *envelopeErr) Unwrap() error {
+	return e.err
+}
+
+func newEnvelopeErr(code int, msg string, err error) *envelopeErr {
+	return &envelopeErr{err: err, apiErr: APIError{Code: code, Message: msg}}
+}
+
+// readEnvelopeErr classifies a failure to read the request body. A body over the
+// limit results in a 413, and anything else in a 400 with the provided message.
+func readEnvelopeErr(msg string, err error) *envelopeErr {
+	if maxErr := new(http.MaxBytesError); errors.As(err, &maxErr) {
+		return newEnvelopeErr(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds the limit of %d bytes", maxErr.Limit), err)
+	}
+	return newEnvelopeErr(http.StatusBadRequest, msg, err)
+}
+
+// headerDeadline is the envelope header that may carry the deadline of the invocation,
+// as an RFC 3339 timestamp. The envelope's deadline field takes precedence over it.
+const headerDeadline = "X-Cs-Deadline"
+
+func toRequest(req *http.Request) (Request, time.Time, func() error, error) {
 	fromFn := fromJSONReq
-	if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
-		fromFn = fromMultipartReq
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		switch {
+		case err != nil:
+			return Request{}, time.Time{}, nil, newEnvelopeErr(http.StatusUnsupportedMediaType, "invalid content type", fmt.Errorf("failed to parse content type %q: %w", ct, err))
+		case mediaType == "multipart/form-data":
+			fromFn = fromMultipartReq
+		case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		default:
+			return Request{}, time.Time{}, nil, newEnvelopeErr(
+				http.StatusUnsupportedMediaType,
+				"unsupported content type, expected application/json or multipart/form-data",
+				fmt.Errorf("unsupported content type: %q", ct),
+			)
+		}
 	}
 
 	r, body, err := fromFn(req)
 	if err != nil {
-		return Request{}, nil, fmt.Errorf("failed to prepare request: %w", err)
+		return Request{}, time.Time{}, nil, fmt.Errorf("failed to prepare request: %w", err)
 	}
 
 	// Ensure headers are canonically formatted else header.Get("my-key") won't necessarily work.
@@ -155,7 +354,34 @@ func toRequest(req *http.Request) (Request, func() error, error) {
 	}
 	r.Headers = hCanon
 
-	return reqMetaToRequest(r, body), body.Close, nil
+	deadline, err := envelopeDeadline(r)
+	if err != nil {
+		return Request{}, time.Time{}, body.Close, err
+	}
+
+	return reqMetaToRequest(r, body), deadline, body.Close, nil
+}
+
+// envelopeDeadline returns the deadline of the invocation from the envelope, or the
+// zero time when none is provided.
+func envelopeDeadline(r reqMeta) (time.Time, error) {
+	v := r.Deadline
+	if v == "" {
+		v = r.Headers.Get(headerDeadline)
+	}
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	deadline, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, newEnvelopeErr(
+			http.StatusBadRequest,
+			"invalid deadline, expected an RFC 3339 timestamp",
+			fmt.Errorf("failed to parse deadline %q: %w", v, err),
+		)
+	}
+	return deadline, nil
 }
 
 type reqMeta struct {
@@ -168,6 +394,7 @@ type reqMeta struct {
 	Queries     url.Values      `json:"query"`
 	URL         string          `json:"url"`
 	TraceID     string          `json:"trace_id"`
+	Deadline    string          `json:"deadline,omitempty"`
 }
 
 func reqMetaToRequest(r reqMeta, body io.Reader) Request {
@@ -186,15 +413,27 @@ func reqMetaToRequest(r reqMeta, body io.Reader) Request {
 }
 
 func fromMultipartReq(req *http.Request) (reqMeta, io.ReadCloser, error) {
+	if err := req.ParseMultipartForm(32 * mb); err != nil {
+		return reqMeta{}, nil, readEnvelopeErr("malformed multipart request", fmt.Errorf("failed to parse multipart form: %w", err))
+	}
+
 	meta := req.FormValue("meta")
 	if meta == "" {
-		return reqMeta{}, nil, errors.New("no meta field provided in multipart form submission")
+		return reqMeta{}, nil, newEnvelopeErr(
+			http.StatusBadRequest,
+			"multipart request is missing the meta field",
+			errors.New("no meta field provided in multipart form submission"),
+		)
 	}
 
 	var reqFn reqMeta
 	err := json.Unmarshal([]byte(meta), &reqFn)
 	if err != nil {
-		return reqMeta{}, nil, fmt.Errorf("failed to json unmarshal meta from multipart field: %w", err)
+		return reqMeta{}, nil, newEnvelopeErr(
+			http.StatusBadRequest,
+			"multipart meta field is not a valid request envelope",
+			fmt.Errorf("failed to json unmarshal meta from multipart field: %w", err),
+		)
 	}
 
 	mpf := req.MultipartForm
@@ -205,7 +444,11 @@ func fromMultipartReq(req *http.Request) (reqMeta, io.ReadCloser, error) {
 
 	body, _, err := req.FormFile("body")
 	if err != nil {
-		return reqMeta{}, nil, fmt.Errorf("failed to read multipart body form file: %w", err)
+		return reqMeta{}, nil, newEnvelopeErr(
+			http.StatusBadRequest,
+			"multipart request is missing the body file",
+			fmt.Errorf("failed to read multipart body form file: %w", err),
+		)
 	}
 
 	return reqFn, body, nil
@@ -247,30 +490,41 @@ func fromJSONReq(req *http.Request) (reqMeta, io.ReadCloser, error) {
 		reqMeta
 		Body json.RawMessage `json:"body"`
 	}
-	payload, err := io.ReadAll(io.LimitReader(req.Body, 5*mb))
+	payload, err := io.ReadAll(req.Body)
 	if err != nil {
-		return reqMeta{}, nil, fmt.Errorf("failed to read request body: %s", err)
+		return reqMeta{}, nil, readEnvelopeErr("failed to read request body", fmt.Errorf("failed to read request body: %w", err))
 	}
 
 	if err = json.Unmarshal(payload, &r); err != nil {
-		return reqMeta{}, nil, fmt.Errorf("failed to unmarshal request body: %s", err)
+		return reqMeta{}, nil, newEnvelopeErr(
+			http.StatusBadRequest,
+			"request body is not a valid JSON request envelope",
+			fmt.Errorf("failed to unmarshal request body: %w", err),
+		)
 	}
 
 	return r.reqMeta, io.NopCloser(bytes.NewReader(r.Body)), nil
 }
 
-func writeResponse(logger *slog.Logger, w http.ResponseWriter, resp Response) error {
-	b, err := json.Marshal(struct {
-		Body    json.Marshaler `json:"body,omitempty"`
-		Code    int            `json:"code,omitempty"`
-		Errors  []APIError     `json:"errors"`
-		Headers http.Header    `json:"headers,omitempty"`
-	}{
+// respEnvelope is the response envelope written back to the caller.
+type respEnvelope struct {
+	Body    json.Marshaler `json:"body,omitempty"`
+	Code    int            `json:"code,omitempty"`
+	Errors  []APIError     `json:"errors"`
+	Headers http.Header    `json:"headers,omitempty"`
+}
+
+func newRespEnvelope(resp Response) respEnvelope {
+	return respEnvelope{
 		Body:    resp.Body,
 		Code:    resp.StatusCode(),
 		Errors:  resp.Errors,
 		Headers: resp.Header,
-	})
+	}
+}
+
+func writeResponse(logger *slog.Logger, w http.ResponseWriter, resp Response) error {
+	b, err := json.Marshal(newRespEnvelope(resp))
 	if err != nil {
 		logger.Error("failed to marshal json payload with body", "err", err)
 	}
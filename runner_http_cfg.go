@@ -0,0 +1,151 @@
+package fdk
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// HTTPServerConfig configures the server of the HTTP runner. A zero value field is
+// read from its env var, and otherwise falls back to its default.
+type HTTPServerConfig struct {
+	// ReadTimeout is the maximum duration for reading the entire request, including
+	// the body. Set via CS_HTTP_READ_TIMEOUT. Defaults to no timeout.
+	ReadTimeout time.Duration
+	// ReadHeaderTimeout is the maximum duration for reading the request headers. Set
+	// via CS_HTTP_READ_HEADER_TIMEOUT. Defaults to the ReadTimeout.
+	ReadHeaderTimeout time.Duration
+	// WriteTimeout is the maximum duration before timing out writes of the response.
+	// Set via CS_HTTP_WRITE_TIMEOUT. Defaults to no timeout.
+	WriteTimeout time.Duration
+	// IdleTimeout is the maximum duration to wait for the next request on a keep-alive
+	// connection. Set via CS_HTTP_IDLE_TIMEOUT. Defaults to the ReadTimeout.
+	IdleTimeout time.Duration
+	// ShutdownTimeout is the maximum duration to wait for in-flight requests to finish
+	// once the server is shutting down. Set via CS_HTTP_SHUTDOWN_TIMEOUT. Defaults to 15s.
+	ShutdownTimeout time.Duration
+	// DrainDelay is the duration the server keeps serving requests once the shutdown
+	// starts, while the readiness route reports the function is draining. This gives
+	// the platform a chance to stop routing requests to the function. Set via
+	// CS_HTTP_DRAIN_DELAY. Defaults to no delay.
+	DrainDelay time.Duration
+	// MaxHeaderBytes is the maximum size of the request headers. Set via
+	// CS_HTTP_MAX_HEADER_BYTES. Defaults to 1MB.
+	MaxHeaderBytes int
+	// MaxBodyBytes is the maximum size of the request body. A larger body is answered
+	// with a 413 error. Set via CS_HTTP_MAX_BODY_BYTES. Defaults to 5MB for JSON request
+	// envelopes, while multipart request envelopes are not limited by default.
+	MaxBodyBytes int64
+	// MaxInFlight is the maximum number of requests dispatched to the handler at once.
+	// Requests to the health routes bypass the limit. Set via CS_HTTP_MAX_IN_FLIGHT.
+	// Defaults to no limit.
+	MaxInFlight int
+	// MaxQueue is the maximum number of requests waiting for one of the MaxInFlight
+	// slots. A request arriving to a full queue is answered with a 429 error. Set via
+	// CS_HTTP_MAX_QUEUE. Defaults to no queue.
+	MaxQueue int
+	// QueueTimeout is the maximum duration a request waits in the queue before being
+	// answered with a 503 error. Set via CS_HTTP_QUEUE_TIMEOUT. Defaults to 1s.
+	QueueTimeout time.Duration
+	// RetryAfter is the duration advised to callers in the Retry-After header of
+	// requests shed by the MaxInFlight limit. Set via CS_HTTP_RETRY_AFTER. Defaults to 1s.
+	RetryAfter time.Duration
+}
+
+// WithHTTPServerConfig configures the server of the HTTP runner. Fields set on the
+// provided config take precedence over their env vars.
+func WithHTTPServerConfig(cfg HTTPServerConfig) RunOpt {
+	return func(o *runOpts) {
+		o.httpServer = cfg
+	}
+}
+
+const defaultMaxJSONBodyBytes = 5 * mb
+
+func httpServerCfg(cfg HTTPServerConfig) (HTTPServerConfig, error) {
+	durations := []struct {
+		env string
+		v   *time.Duration
+	}{
+		{env: "CS_HTTP_READ_TIMEOUT", v: &cfg.ReadTimeout},
+		{env: "CS_HTTP_READ_HEADER_TIMEOUT", v: &cfg.ReadHeaderTimeout},
+		{env: "CS_HTTP_WRITE_TIMEOUT", v: &cfg.WriteTimeout},
+		{env: "CS_HTTP_IDLE_TIMEOUT", v: &cfg.IdleTimeout},
+		{env: "CS_HTTP_SHUTDOWN_TIMEOUT", v: &cfg.ShutdownTimeout},
+		{env: "CS_HTTP_DRAIN_DELAY", v: &cfg.DrainDelay},
+		{env: "CS_HTTP_QUEUE_TIMEOUT", v: &cfg.QueueTimeout},
+		{env: "CS_HTTP_RETRY_AFTER", v: &cfg.RetryAfter},
+	}
+	for _, d := range durations {
+		v := os.Getenv(d.env)
+		if *d.v != 0 || v == "" {
+			continue
+		}
+		dur, err := time.ParseDuration(v)
+		if err != nil || dur <= 0 {
+			return HTTPServerConfig{}, fmt.Errorf("invalid %s provided: %q", d.env, v)
+		}
+		*d.v = dur
+	}
+
+	ints := []struct {
+		env string
+		v   *int
+	}{
+		{env: "CS_HTTP_MAX_HEADER_BYTES", v: &cfg.MaxHeaderBytes},
+		{env: "CS_HTTP_MAX_IN_FLIGHT", v: &cfg.MaxInFlight},
+		{env: "CS_HTTP_MAX_QUEUE", v: &cfg.MaxQueue},
+	}
+	for _, i := range ints {
+		v := os.Getenv(i.env)
+		if *i.v != 0 || v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return HTTPServerConfig{}, fmt.Errorf("invalid %s provided: %q", i.env, v)
+		}
+		*i.v = n
+	}
+
+	if v := os.Getenv("CS_HTTP_MAX_BODY_BYTES"); cfg.MaxBodyBytes == 0 && v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return HTTPServerConfig{}, fmt.Errorf("invalid CS_HTTP_MAX_BODY_BYTES provided: %q", v)
+		}
+		cfg.MaxBodyBytes = n
+	}
+
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = 15 * time.Second
+	}
+	if cfg.MaxHeaderBytes == 0 {
+		cfg.MaxHeaderBytes = mb
+	}
+	if cfg.QueueTimeout == 0 {
+		cfg.QueueTimeout = time.Second
+	}
+	if cfg.RetryAfter == 0 {
+		cfg.RetryAfter = time.Second
+	}
+
+	return cfg, nil
+}
+
+// limitBody limits the size of the request body. Reading past the limit fails with
+// an *http.MaxBytesError, which is answered with a 413 error.
+func limitBody(maxBodyBytes int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		limit := maxBodyBytes
+		if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); limit == 0 && mediaType != "multipart/form-data" {
+			limit = defaultMaxJSONBodyBytes
+		}
+		if limit > 0 {
+			req.Body = http.MaxBytesReader(w, req.Body, limit)
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,101 @@
+package fdk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// runJSONL executes the handler for each request envelope read, one per line, from stdin
+// and writes the response envelope, one per line, to stdout. Logs are written to stderr
+// so they do not interleave with the responses.
+func runJSONL(ctx context.Context, newHandlerFn func(context.Context, *slog.Logger) Handler) {
+	logger := newRunnerLogger(runOptsFrom(ctx), os.Stderr)
+
+	handler := newHandlerFn(ctx, logger)
+
+	if err := runJSONLines(ctx, logger, handler, os.Stdin, os.Stdout); err != nil {
+		logger.Error("unexpected shutdown of jsonl runner", "err", err)
+	}
+}
+
+func runJSONLines(ctx context.Context, logger *slog.Logger, handler Handler, in io.Reader, out io.Writer) error {
+	dispatch := dispatchReq(logger, handler)
+
+	br, bw := bufio.NewReader(in), bufio.NewWriter(out)
+	for lineNum := 1; ; lineNum++ {
+		if err := ctx.Err(); err != nil {
+			return bw.Flush()
+		}
+
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			return bw.Flush()
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read line %d: %w", lineNum, err)
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		resp, err := dispatchEnvelope(ctx, logger, dispatch, line)
+		if err != nil {
+			return fmt.Errorf("failed to dispatch line %d: %w", lineNum, err)
+		}
+
+		if _, err := bw.Write(append(resp, '\n')); err != nil {
+			return fmt.Errorf("failed to write response for line %d: %w", lineNum, err)
+		}
+		if err := bw.Flush(); err != nil {
+			return fmt.Errorf("failed to flush response for line %d: %w", lineNum, err)
+		}
+	}
+}
+
+// dispatchEnvelope dispatches the JSON request envelope through the same path as the
+// HTTP runner and returns the response envelope.
+func dispatchEnvelope(ctx context.Context, logger *slog.Logger, dispatch http.Handler, envelope []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", bytes.NewReader(envelope))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	lw := &lineWriter{header: make(http.Header)}
+	dispatch.ServeHTTP(lw, req)
+	if lw.buf.Len() == 0 {
+		logger.Error("no response written for request")
+		err = writeResponse(logger, lw, ErrResp(APIError{Code: http.StatusInternalServerError, Message: "unable to process incoming request"}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to write response: %w", err)
+		}
+	}
+
+	return lw.buf.Bytes(), nil
+}
+
+// lineWriter captures the response envelope written by dispatchReq. The status code is
+// carried within the envelope, so it is ignored here.
+type lineWriter struct {
+	header http.Header
+	buf    bytes.Buffer
+}
+
+func (l *lineWriter) Header() http.Header {
+	return l.header
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	return l.buf.Write(p)
+}
+
+func (l *lineWriter) WriteHeader(int) {}
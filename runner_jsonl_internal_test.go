@@ -0,0 +1,75 @@
+package fdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRunJSONLines(t *testing.T) {
+	mux := NewMux()
+	mux.Post("/echo", HandlerFn(func(ctx context.Context, r Request) Response {
+		b, _ := io.ReadAll(r.Body)
+		return Response{
+			Code:   http.StatusCreated,
+			Body:   json.RawMessage(b),
+			Header: http.Header{"X-Trace": []string{r.TraceID}},
+		}
+	}))
+
+	in := strings.Join([]string{
+		`{"method":"POST","url":"/echo","body":{"name":"frodo"},"trace_id":"t1"}`,
+		``,
+		`{"method":"GET","url":"/nope"}`,
+		`{"method":"POST","url":"/echo","body":`,
+		`{"method":"POST","url":"/echo","body":{"name":"sam"},"trace_id":"t2"}`,
+	}, "\n")
+
+	var out bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	err := runJSONLines(context.Background(), logger, mux, strings.NewReader(in), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	type respEnvelope struct {
+		Body    json.RawMessage `json:"body"`
+		Code    int             `json:"code"`
+		Errors  []APIError      `json:"errors"`
+		Headers http.Header     `json:"headers"`
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if !EqualVals(t, 4, len(lines)) {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+
+	var got []respEnvelope
+	for _, line := range lines {
+		var resp respEnvelope
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("failed to unmarshal response line %q: %s", line, err)
+		}
+		got = append(got, resp)
+	}
+
+	EqualVals(t, http.StatusCreated, got[0].Code)
+	EqualVals(t, `{"name":"frodo"}`, string(got[0].Body))
+	EqualVals(t, "t1", got[0].Headers.Get("X-Trace"))
+
+	EqualVals(t, http.StatusNotFound, got[1].Code)
+
+	EqualVals(t, http.StatusBadRequest, got[2].Code)
+	if EqualVals(t, 1, len(got[2].Errors)) {
+		EqualVals(t, "request body is not a valid JSON request envelope", got[2].Errors[0].Message)
+	}
+
+	EqualVals(t, http.StatusCreated, got[3].Code)
+	EqualVals(t, `{"name":"sam"}`, string(got[3].Body))
+	EqualVals(t, "t2", got[3].Headers.Get("X-Trace"))
+}
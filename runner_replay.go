@@ -0,0 +1,378 @@
+package fdk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// runReplay replays a corpus of recorded request envelopes against the handler and diffs
+// each response against its golden response. The runner is configured via env vars:
+//
+//	CS_REPLAY_CORPUS      (required) a .jsonl file, a .json file, or a directory of them
+//	CS_REPLAY_GOLDEN_DIR  directory of golden responses, one file per request
+//	CS_REPLAY_UPDATE      when true, writes the responses to CS_REPLAY_GOLDEN_DIR
+//	CS_REPLAY_IGNORE      comma separated JSON pointers, i.e. /headers/Date, to skip in diffs
+//
+// Each entry of the corpus is either a request envelope, or a record with the request
+// envelope under "request" and, optionally, the golden response under "response" and an
+// "id". Golden responses in CS_REPLAY_GOLDEN_DIR take precedence over inline ones. The
+// report is written to stdout and logs to stderr. When any response differs from its
+// golden response, the process exits with a status of 1 once the shutdown hooks have run,
+// and with a status of 2 when the corpus fails to replay.
+func runReplay(ctx context.Context, newHandlerFn func(context.Context, *slog.Logger) Handler) {
+	logger := newRunnerLogger(runOptsFrom(ctx), os.Stderr)
+
+	cfg := replayCfg{
+		corpus:    os.Getenv("CS_REPLAY_CORPUS"),
+		goldenDir: os.Getenv("CS_REPLAY_GOLDEN_DIR"),
+	}
+	if v := os.Getenv("CS_REPLAY_UPDATE"); v != "" {
+		update, err := strconv.ParseBool(v)
+		if err != nil {
+			panic(fmt.Sprintf("invalid CS_REPLAY_UPDATE provided: %q", v))
+		}
+		cfg.update = update
+	}
+	if v := os.Getenv("CS_REPLAY_IGNORE"); v != "" {
+		cfg.ignore = strings.Split(v, ",")
+	}
+
+	handler := newHandlerFn(ctx, logger)
+
+	summary, err := replayCorpus(ctx, logger, handler, cfg, os.Stdout)
+	if err != nil {
+		logger.Error("failed to replay corpus", "err", err)
+		setExitCode(ctx, 2)
+		return
+	}
+	if summary.failed > 0 {
+		setExitCode(ctx, 1)
+	}
+}
+
+type replayCfg struct {
+	corpus    string
+	goldenDir string
+	update    bool
+	ignore    []string
+}
+
+type replaySummary struct {
+	passed, failed, missing, updated int
+}
+
+type replayEntry struct {
+	id       string
+	request  json.RawMessage
+	response json.RawMessage
+}
+
+// replayRecord is a corpus entry that carries the request envelope alongside its
+// golden response.
+type replayRecord struct {
+	ID       string          `json:"id,omitempty"`
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+func replayCorpus(ctx context.Context, logger *slog.Logger, handler Handler, cfg replayCfg, out io.Writer) (replaySummary, error) {
+	if cfg.corpus == "" {
+		return replaySummary{}, errors.New("no corpus provided, set CS_REPLAY_CORPUS")
+	}
+	if cfg.update && cfg.goldenDir == "" {
+		return replaySummary{}, errors.New("updating golden responses requires CS_REPLAY_GOLDEN_DIR")
+	}
+
+	entries, err := readCorpus(cfg.corpus)
+	if err != nil {
+		return replaySummary{}, err
+	}
+
+	dispatch := dispatchReq(logger, handler)
+
+	var summary replaySummary
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+
+		got, err := dispatchEnvelope(ctx, logger, dispatch, entry.request)
+		if err != nil {
+			return summary, fmt.Errorf("failed to dispatch %s: %w", entry.id, err)
+		}
+
+		goldenFile := ""
+		if cfg.goldenDir != "" {
+			goldenFile = filepath.Join(cfg.goldenDir, goldenFilename(entry.id))
+		}
+
+		if cfg.update {
+			if err := writeGolden(goldenFile, got); err != nil {
+				return summary, fmt.Errorf("failed to write golden response for %s: %w", entry.id, err)
+			}
+			summary.updated++
+			fmt.Fprintf(out, "UPDATE %s\n", entry.id)
+			continue
+		}
+
+		want := entry.response
+		if goldenFile != "" {
+			b, err := os.ReadFile(goldenFile)
+			switch {
+			case err == nil:
+				want = b
+			case !errors.Is(err, fs.ErrNotExist):
+				return summary, fmt.Errorf("failed to read golden response for %s: %w", entry.id, err)
+			}
+		}
+		if len(want) == 0 {
+			summary.missing++
+			fmt.Fprintf(out, "NEW  %s (no golden response)\n", entry.id)
+			continue
+		}
+
+		diffs, err := diffResponses(want, got, cfg.ignore)
+		if err != nil {
+			return summary, fmt.Errorf("failed to diff %s: %w", entry.id, err)
+		}
+		if len(diffs) == 0 {
+			summary.passed++
+			fmt.Fprintf(out, "PASS %s\n", entry.id)
+			continue
+		}
+
+		summary.failed++
+		fmt.Fprintf(out, "FAIL %s\n", entry.id)
+		for _, d := range diffs {
+			fmt.Fprintf(out, "\t%s\n", d)
+		}
+	}
+
+	fmt.Fprintf(out, "replayed %d requests: %d passed, %d failed, %d without golden response, %d updated\n",
+		len(entries), summary.passed, summary.failed, summary.missing, summary.updated)
+
+	return summary, nil
+}
+
+func readCorpus(path string) ([]replayEntry, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read corpus: %w", err)
+	}
+	if !fi.IsDir() {
+		return readCorpusFile(path, filepath.Base(path))
+	}
+
+	var entries []replayEntry
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if ext := filepath.Ext(p); ext != ".json" && ext != ".jsonl" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+
+		fileEntries, err := readCorpusFile(p, filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		entries = append(entries, fileEntries...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read corpus: %w", err)
+	}
+	return entries, nil
+}
+
+func readCorpusFile(filename, name string) ([]replayEntry, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read corpus file: %w", err)
+	}
+
+	if filepath.Ext(filename) != ".jsonl" {
+		entry, err := newReplayEntry(name, bytes.TrimSpace(b))
+		if err != nil {
+			return nil, fmt.Errorf("invalid corpus file %s: %w", name, err)
+		}
+		return []replayEntry{entry}, nil
+	}
+
+	var entries []replayEntry
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(nil, len(b)+1)
+	for lineNum := 1; sc.Scan(); lineNum++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		id := name + ":" + strconv.Itoa(lineNum)
+		entry, err := newReplayEntry(id, append([]byte(nil), line...))
+		if err != nil {
+			return nil, fmt.Errorf("invalid corpus entry %s: %w", id, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read corpus file %s: %w", name, err)
+	}
+	return entries, nil
+}
+
+func newReplayEntry(id string, b []byte) (replayEntry, error) {
+	var rec replayRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return replayEntry{}, err
+	}
+	if len(rec.Request) == 0 {
+		// a bare request envelope
+		return replayEntry{id: id, request: b}, nil
+	}
+	if rec.ID != "" {
+		id = rec.ID
+	}
+	return replayEntry{id: id, request: rec.Request, response: rec.Response}, nil
+}
+
+func goldenFilename(id string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", ":", "_", " ", "_").Replace(id) + ".golden.json"
+}
+
+func writeGolden(filename string, resp []byte) error {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, resp, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+// diffResponses compares the response envelopes, returning a line per difference keyed by
+// the JSON pointer of the differing value. This covers the status code, headers, body,
+// errors, and the checksums of File responses. A golden value redacted by the traffic
+// capture matches any value.
+func diffResponses(want, got []byte, ignore []string) ([]string, error) {
+	wantV, err := decodeJSONNumbers(want)
+	if err != nil {
+		return nil, fmt.Errorf("invalid golden response: %w", err)
+	}
+	gotV, err := decodeJSONNumbers(got)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+
+	var diffs []string
+	diffJSON("", wantV, gotV, ignore, &diffs)
+	return diffs, nil
+}
+
+func decodeJSONNumbers(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var v any
+	err := dec.Decode(&v)
+	return v, err
+}
+
+func diffJSON(path string, want, got any, ignore []string, diffs *[]string) {
+	for _, ig := range ignore {
+		if path == ig || strings.HasPrefix(path, strings.TrimSuffix(ig, "/")+"/") {
+			return
+		}
+	}
+	if want == redacted {
+		return
+	}
+
+	wantM, wantIsMap := want.(map[string]any)
+	gotM, gotIsMap := got.(map[string]any)
+	if wantIsMap && gotIsMap {
+		keys := make(map[string]bool)
+		for k := range wantM {
+			keys[k] = true
+		}
+		for k := range gotM {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		for _, k := range sorted {
+			wantV, ok := wantM[k]
+			if !ok {
+				wantV = jsonMissing{}
+			}
+			gotV, ok := gotM[k]
+			if !ok {
+				gotV = jsonMissing{}
+			}
+			diffJSON(path+"/"+escapeJSONPointer(k), wantV, gotV, ignore, diffs)
+		}
+		return
+	}
+
+	wantS, wantIsSlice := want.([]any)
+	gotS, gotIsSlice := got.([]any)
+	if wantIsSlice && gotIsSlice && len(wantS) == len(gotS) {
+		for i := range wantS {
+			diffJSON(path+"/"+strconv.Itoa(i), wantS[i], gotS[i], ignore, diffs)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		if path == "" {
+			path = "/"
+		}
+		*diffs = append(*diffs, fmt.Sprintf("%s: want %s, got %s", path, jsonString(want), jsonString(got)))
+	}
+}
+
+func escapeJSONPointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+// jsonMissing marks a key that is absent from an object, as opposed to a null value.
+type jsonMissing struct{}
+
+func jsonString(v any) string {
+	if _, ok := v.(jsonMissing); ok {
+		return "<missing>"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
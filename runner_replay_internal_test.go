@@ -0,0 +1,228 @@
+package fdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplayCorpus(t *testing.T) {
+	var greeting = "hello"
+	newMux := func() *Mux {
+		mux := NewMux()
+		mux.Post("/greet", HandleFnOf(func(ctx context.Context, r RequestOf[struct {
+			Name string `json:"name"`
+		}]) Response {
+			return Response{
+				Code:   http.StatusOK,
+				Body:   JSON(map[string]string{"greeting": greeting + " " + r.Body.Name}),
+				Header: http.Header{"X-Volatile": []string{r.TraceID}},
+			}
+		}))
+		return mux
+	}
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+	corpusDir := t.TempDir()
+	writeTestFile(t, filepath.Join(corpusDir, "requests.jsonl"), strings.Join([]string{
+		`{"method":"POST","url":"/greet","body":{"name":"frodo"},"trace_id":"t1"}`,
+		`{"method":"GET","url":"/nope"}`,
+	}, "\n"))
+	writeTestFile(t, filepath.Join(corpusDir, "nested", "single.json"), `{"method":"POST","url":"/greet","body":{"name":"sam"}}`)
+	writeTestFile(t, filepath.Join(corpusDir, "ignored.txt"), `not a corpus file`)
+
+	goldenDir := filepath.Join(t.TempDir(), "golden")
+
+	t.Run("updating should write golden responses", func(t *testing.T) {
+		var out bytes.Buffer
+		summary, err := replayCorpus(context.Background(), logger, newMux(), replayCfg{
+			corpus:    corpusDir,
+			goldenDir: goldenDir,
+			update:    true,
+		}, &out)
+		mustNoErrInternal(t, err)
+
+		EqualVals(t, 3, summary.updated)
+		for _, name := range []string{"requests.jsonl_1.golden.json", "requests.jsonl_2.golden.json", "nested_single.json.golden.json"} {
+			if _, err := os.Stat(filepath.Join(goldenDir, name)); err != nil {
+				t.Errorf("missing golden file %s: %s", name, err)
+			}
+		}
+	})
+
+	t.Run("unchanged behavior should pass", func(t *testing.T) {
+		var out bytes.Buffer
+		summary, err := replayCorpus(context.Background(), logger, newMux(), replayCfg{
+			corpus:    corpusDir,
+			goldenDir: goldenDir,
+		}, &out)
+		mustNoErrInternal(t, err)
+
+		EqualVals(t, 3, summary.passed)
+		EqualVals(t, 0, summary.failed)
+	})
+
+	t.Run("changed behavior should fail with diffs", func(t *testing.T) {
+		greeting = "hi"
+		defer func() { greeting = "hello" }()
+
+		var out bytes.Buffer
+		summary, err := replayCorpus(context.Background(), logger, newMux(), replayCfg{
+			corpus:    corpusDir,
+			goldenDir: goldenDir,
+		}, &out)
+		mustNoErrInternal(t, err)
+
+		EqualVals(t, 1, summary.passed)
+		EqualVals(t, 2, summary.failed)
+
+		report := out.String()
+		wantLines := []string{
+			"FAIL requests.jsonl:1",
+			`	/body/greeting: want "hello frodo", got "hi frodo"`,
+			"PASS requests.jsonl:2",
+			"FAIL nested/single.json",
+			`	/body/greeting: want "hello sam", got "hi sam"`,
+		}
+		for _, want := range wantLines {
+			if !strings.Contains(report, want+"\n") {
+				t.Errorf("report missing line %q:\n%s", want, report)
+			}
+		}
+	})
+
+	t.Run("inline golden responses and ignored paths", func(t *testing.T) {
+		corpus := filepath.Join(t.TempDir(), "records.jsonl")
+		writeTestFile(t, corpus, strings.Join([]string{
+			`{"id":"greet-frodo","request":{"method":"POST","url":"/greet","body":{"name":"frodo"},"trace_id":"new"},"response":{"body":{"greeting":"hello frodo"},"code":200,"errors":null,"headers":{"X-Volatile":["old"]}}}`,
+			`{"request":{"method":"POST","url":"/greet","body":{"name":"sam"}},"response":{"body":{"greeting":"hello sam"},"code":201,"errors":null}}`,
+			`{"request":{"method":"POST","url":"/greet","body":{"name":"pippin"}}}`,
+		}, "\n"))
+
+		var out bytes.Buffer
+		summary, err := replayCorpus(context.Background(), logger, newMux(), replayCfg{
+			corpus: corpus,
+			ignore: []string{"/headers/X-Volatile"},
+		}, &out)
+		mustNoErrInternal(t, err)
+
+		EqualVals(t, 1, summary.passed)
+		EqualVals(t, 1, summary.failed)
+		EqualVals(t, 1, summary.missing)
+
+		report := out.String()
+		for _, want := range []string{
+			"PASS greet-frodo",
+			"FAIL records.jsonl:2",
+			"\t/code: want 201, got 200",
+			`	/headers: want <missing>, got {"X-Volatile":[""]}`,
+			"NEW  records.jsonl:3 (no golden response)",
+		} {
+			if !strings.Contains(report, want+"\n") {
+				t.Errorf("report missing line %q:\n%s", want, report)
+			}
+		}
+	})
+}
+
+func TestDiffResponses_fileChecksum(t *testing.T) {
+	want, _ := json.Marshal(map[string]any{"body": map[string]any{"sha256_checksum": "abc", "size": "3"}, "code": 201})
+	got, _ := json.Marshal(map[string]any{"body": map[string]any{"sha256_checksum": "xyz", "size": "3"}, "code": 201})
+
+	diffs, err := diffResponses(want, got, nil)
+	mustNoErrInternal(t, err)
+
+	if EqualVals(t, 1, len(diffs)) {
+		EqualVals(t, `/body/sha256_checksum: want "abc", got "xyz"`, diffs[0])
+	}
+}
+
+func TestDiffResponses_redacted(t *testing.T) {
+	want, _ := json.Marshal(map[string]any{"body": map[string]any{"session": redacted, "user": "frodo"}, "code": 200})
+	got, _ := json.Marshal(map[string]any{"body": map[string]any{"session": "s3cr3t", "user": "sam"}, "code": 200})
+
+	diffs, err := diffResponses(want, got, nil)
+	mustNoErrInternal(t, err)
+
+	if EqualVals(t, 1, len(diffs)) {
+		EqualVals(t, `/body/user: want "frodo", got "sam"`, diffs[0])
+	}
+}
+
+func writeTestFile(t *testing.T, filename, contents string) {
+	t.Helper()
+
+	mustNoErrInternal(t, os.MkdirAll(filepath.Dir(filename), 0755))
+	mustNoErrInternal(t, os.WriteFile(filename, []byte(contents), 0644))
+}
+
+func mustNoErrInternal(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("received unexpected err:\n\t\tgot:\t%s", err)
+	}
+}
+
+func TestRunReplay(t *testing.T) {
+	newHandlerFn := func(context.Context, *slog.Logger) Handler {
+		mux := NewMux()
+		mux.Get("/ping", HandlerFn(func(ctx context.Context, r Request) Response {
+			return Response{Code: http.StatusOK, Body: JSON(map[string]string{"msg": "pong"})}
+		}))
+		return mux
+	}
+
+	tests := []struct {
+		name     string
+		corpus   string
+		wantCode int32
+	}{
+		{
+			name:     "matching responses should leave the exit code unset",
+			corpus:   `{"request":{"method":"GET","url":"/ping"},"response":{"code":200,"body":{"msg":"pong"},"errors":null}}`,
+			wantCode: 0,
+		},
+		{
+			name:     "differing responses should set an exit code of 1",
+			corpus:   `{"request":{"method":"GET","url":"/ping"},"response":{"code":200,"body":{"msg":"ping"},"errors":null}}`,
+			wantCode: 1,
+		},
+		{
+			name:     "an invalid corpus should set an exit code of 2",
+			corpus:   `not json`,
+			wantCode: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			corpus := filepath.Join(t.TempDir(), "corpus.jsonl")
+			writeTestFile(t, corpus, tt.corpus)
+			t.Setenv("CS_REPLAY_CORPUS", corpus)
+			t.Setenv("CS_LOG_OUTPUT", filepath.Join(t.TempDir(), "fn.log"))
+
+			// the report is written to stdout
+			stdout := os.Stdout
+			report, err := os.Create(filepath.Join(t.TempDir(), "report.txt"))
+			mustNoErrInternal(t, err)
+			os.Stdout = report
+			defer func() {
+				os.Stdout = stdout
+				_ = report.Close()
+			}()
+
+			ctx, exitCode := withExitCode(context.Background())
+			runReplay(ctx, newHandlerFn)
+
+			EqualVals(t, tt.wantCode, exitCode.Load())
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"mime/multipart"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path"
@@ -19,9 +20,15 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
 	fdk "github.com/CrowdStrike/foundry-fn-go"
 )
 
@@ -1210,6 +1217,1329 @@ integer: 1`,
 	})
 }
 
+func TestRun_handlerLifecycle(t *testing.T) {
+	doReq := func(t *testing.T, ctx context.Context, addr string) respBody {
+		t.Helper()
+
+		b, err := json.Marshal(map[string]string{"method": http.MethodGet, "url": "/path"})
+		mustNoErr(t, err)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, bytes.NewBuffer(b))
+		mustNoErr(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		mustNoErr(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		var got respBody
+		decodeBody(t, resp.Body, &got)
+		return got
+	}
+
+	tests := []struct {
+		name         string
+		opts         []fdk.RunOpt
+		wantBuilds   int32
+		wantReleases int32
+	}{
+		{
+			name:       "by default the handler is built once and reused across requests",
+			wantBuilds: 1,
+		},
+		{
+			name:         "with handler per request the handler is built and released for every request",
+			opts:         []fdk.RunOpt{fdk.WithHandlerPerRequest()},
+			wantBuilds:   3,
+			wantReleases: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfigFile(t, `{"string": "val","integer": 1}`, "")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var builds, releases atomic.Int32
+			addr := newServer(ctx, t, func(ctx context.Context, _ *slog.Logger, cfg config) fdk.Handler {
+				builds.Add(1)
+				fdk.OnShutdown(ctx, "release", func(context.Context) error {
+					releases.Add(1)
+					return nil
+				})
+
+				m := fdk.NewMux()
+				m.Get("/path", newSimpleHandler(cfg))
+				return m
+			}, tt.opts...)
+
+			for i := 0; i < 3; i++ {
+				got := doReq(t, ctx, addr)
+				fdk.EqualVals(t, 201, got.Code)
+				fdk.EqualVals(t, config{Str: "val", Int: 1}, got.Req.Config)
+			}
+
+			fdk.EqualVals(t, tt.wantBuilds, builds.Load())
+			fdk.EqualVals(t, tt.wantReleases, releases.Load())
+		})
+	}
+
+	t.Run("a panic when constructing the handler should respond with errors", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		addr := newServer(ctx, t, func(ctx context.Context, _ *slog.Logger, _ fdk.SkipCfg) fdk.Handler {
+			panic("kaboom")
+		})
+
+		got := doReq(t, ctx, addr)
+		fdk.EqualVals(t, http.StatusServiceUnavailable, got.Code)
+		if !fdk.EqualVals(t, 1, len(got.Errs)) {
+			return
+		}
+		fdk.EqualVals(t, fdk.APIError{Code: http.StatusServiceUnavailable, Message: "encountered unexpected error"}, got.Errs[0])
+	})
+}
+
+func TestRun_invalidConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []fdk.RunOpt
+		wantMsgs []string
+	}{
+		{
+			name:     "should log the validation error",
+			wantMsgs: []string{"failed to load config"},
+		},
+		{
+			name:     "with config reload should log the validation error",
+			opts:     []fdk.RunOpt{fdk.WithConfigReload()},
+			wantMsgs: []string{"failed to load config", "failed to load initial config, serving errors until a valid config is loaded"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfigFile(t, `{"string": "invalid","integer": 1}`, "")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			logFile := filepath.Join(t.TempDir(), "fn.log")
+			t.Setenv("CS_LOG_OUTPUT", logFile)
+
+			newServer(ctx, t, func(ctx context.Context, _ *slog.Logger, cfg config) fdk.Handler {
+				return fdk.NewMux()
+			}, tt.opts...)
+
+			for _, msg := range tt.wantMsgs {
+				logs := readLogLines(t, logFile, msg)
+				if fdk.EqualVals(t, 1, len(logs), "msg: %s", msg) {
+					fdk.EqualVals(t, true, strings.Contains(logs[0].Err, `invalid config "string" field received: invalid`), "err: %s", logs[0].Err)
+				}
+			}
+		})
+	}
+}
+
+func TestRun_configReload(t *testing.T) {
+	writeConfigFile(t, `{"string": "val","integer": 1}`, "")
+	t.Setenv("CS_FN_CONFIG_POLL_INTERVAL", "10ms")
+	cfgFile := os.Getenv("CS_FN_CONFIG_PATH")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logFile := filepath.Join(t.TempDir(), "fn.log")
+	t.Setenv("CS_LOG_OUTPUT", logFile)
+
+	addr := newServer(ctx, t, func(ctx context.Context, _ *slog.Logger, cfg config) fdk.Handler {
+		m := fdk.NewMux()
+		m.Get("/path", newSimpleHandler(cfg))
+		return m
+	}, fdk.WithConfigReload())
+
+	doReq := func(t *testing.T) respBody {
+		t.Helper()
+
+		b, err := json.Marshal(map[string]string{"method": http.MethodGet, "url": "/path"})
+		mustNoErr(t, err)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, bytes.NewBuffer(b))
+		mustNoErr(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		mustNoErr(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		var got respBody
+		decodeBody(t, resp.Body, &got)
+		return got
+	}
+
+	got := doReq(t)
+	fdk.EqualVals(t, 201, got.Code)
+
+	// an invalid config should keep serving the last good config
+	mustNoErr(t, os.WriteFile(cfgFile, []byte(`{"string": "invalid","integer": 1}`), 0666))
+	time.Sleep(100 * time.Millisecond)
+
+	got = doReq(t)
+	fdk.EqualVals(t, 201, got.Code)
+	fdk.EqualVals(t, config{Str: "val", Int: 1}, got.Req.Config)
+	fdk.EqualVals(t, 1, len(readLogLines(t, logFile, "failed to load config")))
+	fdk.EqualVals(t, 1, len(readLogLines(t, logFile, "failed to reload config, continuing to serve last good config")))
+
+	// a valid config should swap in the newly built handler
+	mustNoErr(t, os.WriteFile(cfgFile, []byte(`{"string": "val","integer": 1,"err": true}`), 0666))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		got = doReq(t)
+		if got.Code != 201 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fdk.EqualVals(t, http.StatusInternalServerError, got.Code)
+}
+
+func TestRun_listeners(t *testing.T) {
+	newHandler := func(ctx context.Context, _ *slog.Logger, _ fdk.SkipCfg) fdk.Handler {
+		m := fdk.NewMux()
+		m.Get("/path", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+			return fdk.Response{Code: http.StatusCreated}
+		}))
+		return m
+	}
+
+	doReq := func(t *testing.T, ctx context.Context, client *http.Client, addr string) int {
+		t.Helper()
+
+		b, err := json.Marshal(map[string]string{"method": http.MethodGet, "url": "/path"})
+		mustNoErr(t, err)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, bytes.NewBuffer(b))
+		mustNoErr(t, err)
+
+		resp, err := client.Do(req)
+		mustNoErr(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		var got respBody
+		decodeBody(t, resp.Body, &got)
+		return got.Code
+	}
+
+	t.Run("with an injected listener should serve requests on it", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		l, err := net.Listen("tcp", "127.0.0.1:")
+		mustNoErr(t, err)
+
+		go fdk.Run(ctx, newHandler, fdk.WithListener(l))
+
+		code := doReq(t, ctx, http.DefaultClient, "http://"+l.Addr().String())
+		fdk.EqualVals(t, http.StatusCreated, code)
+	})
+
+	t.Run("with a unix socket should serve requests on it and remove a stale socket", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "fn.sock")
+
+		// a socket file left behind by a previous process
+		stale, err := net.Listen("unix", socket)
+		mustNoErr(t, err)
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		mustNoErr(t, stale.Close())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			fdk.Run(ctx, newHandler, fdk.WithUnixSocket(socket, 0600))
+		}()
+
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if conn, err := net.Dial("unix", socket); err == nil {
+				_ = conn.Close()
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		code := doReq(t, ctx, client, "http://unix")
+		fdk.EqualVals(t, http.StatusCreated, code)
+
+		fi, err := os.Stat(socket)
+		mustNoErr(t, err)
+		fdk.EqualVals(t, os.FileMode(0600), fi.Mode().Perm())
+
+		cancel()
+		<-done
+
+		if _, err := os.Stat(socket); !os.IsNotExist(err) {
+			t.Errorf("expected socket to be removed on shutdown, got err: %v", err)
+		}
+	})
+
+	t.Run("with a unix socket path that is not a socket should not serve", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "fn.sock")
+		mustNoErr(t, os.WriteFile(socket, []byte("not a socket"), 0600))
+		t.Setenv("CS_HTTP_UNIX_SOCKET", socket)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			fdk.Run(context.Background(), newHandler)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected run to return")
+		}
+
+		b, err := os.ReadFile(socket)
+		mustNoErr(t, err)
+		fdk.EqualVals(t, "not a socket", string(b))
+	})
+}
+
+func TestRun_httpServerConfig(t *testing.T) {
+	jsonBody := func(size int) func(t *testing.T) (*bytes.Buffer, string) {
+		return func(t *testing.T) (*bytes.Buffer, string) {
+			b, err := json.Marshal(map[string]any{
+				"method": http.MethodPost,
+				"url":    "/path",
+				"body":   map[string]string{"data": strings.Repeat("a", size)},
+			})
+			mustNoErr(t, err)
+			return bytes.NewBuffer(b), "application/json"
+		}
+	}
+	multipartBody := func(size int) func(t *testing.T) (*bytes.Buffer, string) {
+		return func(t *testing.T) (*bytes.Buffer, string) {
+			var b bytes.Buffer
+			w := multipart.NewWriter(&b)
+
+			fw, err := w.CreateFormField("meta")
+			mustNoErr(t, err)
+			_, err = fw.Write([]byte(`{"method":"POST", "url":"/path"}`))
+			mustNoErr(t, err)
+
+			fw, err = w.CreateFormFile("body", "data.txt")
+			mustNoErr(t, err)
+			_, err = fw.Write([]byte(strings.Repeat("a", size)))
+			mustNoErr(t, err)
+
+			mustNoErr(t, w.Close())
+			return &b, w.FormDataContentType()
+		}
+	}
+
+	tests := []struct {
+		name     string
+		opts     []fdk.RunOpt
+		env      map[string]string
+		body     func(t *testing.T) (*bytes.Buffer, string)
+		wantCode int
+		wantErrs []fdk.APIError
+	}{
+		{
+			name:     "JSON body within the default limit should pass",
+			body:     jsonBody(1 << 20),
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "JSON body over the default limit should fail with 413",
+			body:     jsonBody(6 << 20),
+			wantCode: http.StatusRequestEntityTooLarge,
+			wantErrs: []fdk.APIError{{Code: http.StatusRequestEntityTooLarge, Message: "request body exceeds the limit of 5242880 bytes"}},
+		},
+		{
+			name:     "multipart body over the JSON default limit should pass",
+			body:     multipartBody(6 << 20),
+			wantCode: http.StatusCreated,
+		},
+		{
+			name: "multipart body with a mixed case content type over the JSON default limit should pass",
+			body: func(t *testing.T) (*bytes.Buffer, string) {
+				b, contentType := multipartBody(6 << 20)(t)
+				return b, strings.Replace(contentType, "multipart/form-data", "Multipart/Form-Data", 1)
+			},
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "JSON body over the configured limit should fail with 413",
+			opts:     []fdk.RunOpt{fdk.WithHTTPServerConfig(fdk.HTTPServerConfig{MaxBodyBytes: 128})},
+			body:     jsonBody(256),
+			wantCode: http.StatusRequestEntityTooLarge,
+			wantErrs: []fdk.APIError{{Code: http.StatusRequestEntityTooLarge, Message: "request body exceeds the limit of 128 bytes"}},
+		},
+		{
+			name:     "multipart body over the limit set via env should fail with 413",
+			env:      map[string]string{"CS_HTTP_MAX_BODY_BYTES": "1024"},
+			body:     multipartBody(2048),
+			wantCode: http.StatusRequestEntityTooLarge,
+			wantErrs: []fdk.APIError{{Code: http.StatusRequestEntityTooLarge, Message: "request body exceeds the limit of 1024 bytes"}},
+		},
+		{
+			name:     "configured limit should take precedence over env",
+			opts:     []fdk.RunOpt{fdk.WithHTTPServerConfig(fdk.HTTPServerConfig{MaxBodyBytes: 4096})},
+			env:      map[string]string{"CS_HTTP_MAX_BODY_BYTES": "128"},
+			body:     jsonBody(256),
+			wantCode: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			addr := newServer(ctx, t, func(ctx context.Context, _ *slog.Logger, _ fdk.SkipCfg) fdk.Handler {
+				m := fdk.NewMux()
+				m.Post("/path", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+					return fdk.Response{Code: http.StatusCreated}
+				}))
+				return m
+			}, tt.opts...)
+
+			body, contentType := tt.body(t)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, body)
+			mustNoErr(t, err)
+			req.Header.Set("Content-Type", contentType)
+
+			resp, err := http.DefaultClient.Do(req)
+			mustNoErr(t, err)
+			defer func() { _ = resp.Body.Close() }()
+
+			var got respBody
+			decodeBody(t, resp.Body, &got)
+
+			fdk.EqualVals(t, tt.wantCode, resp.StatusCode)
+			fdk.EqualVals(t, tt.wantCode, got.Code)
+			fdk.EqualVals(t, len(tt.wantErrs), len(got.Errs))
+			for i := range tt.wantErrs {
+				fdk.EqualVals(t, tt.wantErrs[i], got.Errs[i])
+			}
+		})
+	}
+}
+
+func TestRun_envelopeErrors(t *testing.T) {
+	multipartBody := func(fields map[string]string) func(t *testing.T) (*bytes.Buffer, string) {
+		return func(t *testing.T) (*bytes.Buffer, string) {
+			var b bytes.Buffer
+			w := multipart.NewWriter(&b)
+			for k, v := range fields {
+				mustNoErr(t, w.WriteField(k, v))
+			}
+			mustNoErr(t, w.Close())
+			return &b, w.FormDataContentType()
+		}
+	}
+	rawBody := func(body, contentType string) func(t *testing.T) (*bytes.Buffer, string) {
+		return func(t *testing.T) (*bytes.Buffer, string) {
+			return bytes.NewBufferString(body), contentType
+		}
+	}
+
+	tests := []struct {
+		name    string
+		body    func(t *testing.T) (*bytes.Buffer, string)
+		wantErr fdk.APIError
+	}{
+		{
+			name:    "unsupported content type should fail with 415",
+			body:    rawBody(`{"method":"GET","url":"/path"}`, "text/plain"),
+			wantErr: fdk.APIError{Code: http.StatusUnsupportedMediaType, Message: "unsupported content type, expected application/json or multipart/form-data"},
+		},
+		{
+			name:    "invalid content type should fail with 415",
+			body:    rawBody(`{"method":"GET","url":"/path"}`, "application/"),
+			wantErr: fdk.APIError{Code: http.StatusUnsupportedMediaType, Message: "invalid content type"},
+		},
+		{
+			name:    "malformed JSON envelope should fail with 400",
+			body:    rawBody(`{"method":"GET",`, "application/json"),
+			wantErr: fdk.APIError{Code: http.StatusBadRequest, Message: "request body is not a valid JSON request envelope"},
+		},
+		{
+			name:    "multipart without meta should fail with 400",
+			body:    multipartBody(map[string]string{"body": "{}"}),
+			wantErr: fdk.APIError{Code: http.StatusBadRequest, Message: "multipart request is missing the meta field"},
+		},
+		{
+			name:    "multipart with malformed meta should fail with 400",
+			body:    multipartBody(map[string]string{"meta": `{"method":`}),
+			wantErr: fdk.APIError{Code: http.StatusBadRequest, Message: "multipart meta field is not a valid request envelope"},
+		},
+		{
+			name:    "multipart without a body file should fail with 400",
+			body:    multipartBody(map[string]string{"meta": `{"method":"GET","url":"/path"}`}),
+			wantErr: fdk.APIError{Code: http.StatusBadRequest, Message: "multipart request is missing the body file"},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addr := newServer(ctx, t, func(ctx context.Context, _ *slog.Logger, _ fdk.SkipCfg) fdk.Handler {
+		m := fdk.NewMux()
+		m.Get("/path", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+			return fdk.Response{Code: http.StatusCreated}
+		}))
+		return m
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := tt.body(t)
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, body)
+			mustNoErr(t, err)
+			req.Header.Set("Content-Type", contentType)
+
+			resp, err := http.DefaultClient.Do(req)
+			mustNoErr(t, err)
+			defer func() { _ = resp.Body.Close() }()
+
+			var got respBody
+			decodeBody(t, resp.Body, &got)
+
+			fdk.EqualVals(t, tt.wantErr.Code, resp.StatusCode)
+			if fdk.EqualVals(t, 1, len(got.Errs)) {
+				fdk.EqualVals(t, tt.wantErr, got.Errs[0])
+			}
+		})
+	}
+}
+
+func TestRun_deadlines(t *testing.T) {
+	soon := func() string { return time.Now().Add(50 * time.Millisecond).Format(time.RFC3339Nano) }
+
+	tests := []struct {
+		name     string
+		opts     []fdk.RunOpt
+		env      map[string]string
+		envelope func() map[string]any
+		wantCode int
+		wantErrs []fdk.APIError
+	}{
+		{
+			name:     "a handler within its deadline should pass",
+			opts:     []fdk.RunOpt{fdk.WithHandlerTimeout(time.Minute)},
+			envelope: func() map[string]any { return map[string]any{"url": "/fast"} },
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "a handler overrunning the handler timeout should fail with 504",
+			opts:     []fdk.RunOpt{fdk.WithHandlerTimeout(50 * time.Millisecond)},
+			envelope: func() map[string]any { return map[string]any{"url": "/slow"} },
+			wantCode: http.StatusGatewayTimeout,
+			wantErrs: []fdk.APIError{{Code: http.StatusGatewayTimeout, Message: "handler exceeded its deadline"}},
+		},
+		{
+			name:     "a handler overrunning the timeout set via env should fail with 504",
+			env:      map[string]string{"CS_FN_TIMEOUT": "50ms"},
+			envelope: func() map[string]any { return map[string]any{"url": "/slow"} },
+			wantCode: http.StatusGatewayTimeout,
+			wantErrs: []fdk.APIError{{Code: http.StatusGatewayTimeout, Message: "handler exceeded its deadline"}},
+		},
+		{
+			name:     "a handler overrunning the envelope deadline should fail with 504",
+			envelope: func() map[string]any { return map[string]any{"url": "/slow", "deadline": soon()} },
+			wantCode: http.StatusGatewayTimeout,
+			wantErrs: []fdk.APIError{{Code: http.StatusGatewayTimeout, Message: "handler exceeded its deadline"}},
+		},
+		{
+			name: "a handler overrunning the envelope deadline header should fail with 504",
+			envelope: func() map[string]any {
+				return map[string]any{"url": "/slow", "header": map[string][]string{"X-Cs-Deadline": {soon()}}}
+			},
+			wantCode: http.StatusGatewayTimeout,
+			wantErrs: []fdk.APIError{{Code: http.StatusGatewayTimeout, Message: "handler exceeded its deadline"}},
+		},
+		{
+			name:     "an invalid envelope deadline should fail with 400",
+			envelope: func() map[string]any { return map[string]any{"url": "/fast", "deadline": "tomorrow"} },
+			wantCode: http.StatusBadRequest,
+			wantErrs: []fdk.APIError{{Code: http.StatusBadRequest, Message: "invalid deadline, expected an RFC 3339 timestamp"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			observed := make(chan error, 1)
+			addr := newServer(ctx, t, func(ctx context.Context, _ *slog.Logger, _ fdk.SkipCfg) fdk.Handler {
+				m := fdk.NewMux()
+				m.Get("/fast", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+					return fdk.Response{Code: http.StatusCreated}
+				}))
+				m.Get("/slow", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+					<-ctx.Done()
+					observed <- ctx.Err()
+					return fdk.Response{Code: http.StatusCreated}
+				}))
+				return m
+			}, tt.opts...)
+
+			envelope := tt.envelope()
+			envelope["method"] = http.MethodGet
+			b, err := json.Marshal(envelope)
+			mustNoErr(t, err)
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, bytes.NewBuffer(b))
+			mustNoErr(t, err)
+
+			resp, err := http.DefaultClient.Do(req)
+			mustNoErr(t, err)
+			defer func() { _ = resp.Body.Close() }()
+
+			var got respBody
+			decodeBody(t, resp.Body, &got)
+
+			fdk.EqualVals(t, tt.wantCode, resp.StatusCode)
+			if fdk.EqualVals(t, len(tt.wantErrs), len(got.Errs)) {
+				for i := range tt.wantErrs {
+					fdk.EqualVals(t, tt.wantErrs[i], got.Errs[i])
+				}
+			}
+
+			if tt.wantCode == http.StatusGatewayTimeout {
+				select {
+				case err := <-observed:
+					fdk.EqualVals(t, context.DeadlineExceeded, err)
+				case <-time.After(time.Second):
+					t.Fatal("handler did not observe the cancelled context")
+				}
+			}
+		})
+	}
+}
+
+func TestRun_concurrencyLimit(t *testing.T) {
+	doReq := func(t *testing.T, ctx context.Context, addr, url string) (*http.Response, respBody) {
+		t.Helper()
+
+		b, err := json.Marshal(map[string]string{"method": http.MethodGet, "url": url})
+		mustNoErr(t, err)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, bytes.NewBuffer(b))
+		mustNoErr(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		mustNoErr(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		var got respBody
+		decodeBody(t, resp.Body, &got)
+		return resp, got
+	}
+
+	newHandler := func(started chan<- struct{}, release <-chan struct{}) func(context.Context, *slog.Logger, fdk.SkipCfg) fdk.Handler {
+		return func(ctx context.Context, _ *slog.Logger, _ fdk.SkipCfg) fdk.Handler {
+			m := fdk.NewMux()
+			m.Get("/block", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+				started <- struct{}{}
+				<-release
+				return fdk.Response{Code: http.StatusCreated}
+			}))
+			return m
+		}
+	}
+
+	t.Run("requests over the limit should be queued and then shed", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		started, release := make(chan struct{}, 1), make(chan struct{})
+		addr := newServer(ctx, t, newHandler(started, release), fdk.WithHTTPServerConfig(fdk.HTTPServerConfig{
+			MaxInFlight:  1,
+			MaxQueue:     1,
+			QueueTimeout: 200 * time.Millisecond,
+			RetryAfter:   1500 * time.Millisecond,
+		}))
+
+		inFlight := make(chan int, 1)
+		go func() {
+			resp, _ := doReq(t, ctx, addr, "/block")
+			inFlight <- resp.StatusCode
+		}()
+		<-started
+
+		queued := make(chan respBody, 1)
+		go func() {
+			_, got := doReq(t, ctx, addr, "/block")
+			queued <- got
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		resp, got := doReq(t, ctx, addr, "/block")
+		fdk.EqualVals(t, http.StatusTooManyRequests, resp.StatusCode)
+		fdk.EqualVals(t, "2", resp.Header.Get("Retry-After"))
+		fdk.EqualVals(t, "2", got.Headers.Get("Retry-After"))
+		if fdk.EqualVals(t, 1, len(got.Errs)) {
+			fdk.EqualVals(t, fdk.APIError{Code: http.StatusTooManyRequests, Message: "too many requests in flight"}, got.Errs[0])
+		}
+
+		got = <-queued
+		fdk.EqualVals(t, http.StatusServiceUnavailable, got.Code)
+		if fdk.EqualVals(t, 1, len(got.Errs)) {
+			fdk.EqualVals(t, fdk.APIError{Code: http.StatusServiceUnavailable, Message: "timed out waiting for capacity to handle request"}, got.Errs[0])
+		}
+
+		close(release)
+		fdk.EqualVals(t, http.StatusCreated, <-inFlight)
+	})
+
+	t.Run("queued requests should be dispatched once capacity frees up", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		started, release := make(chan struct{}, 2), make(chan struct{})
+		addr := newServer(ctx, t, newHandler(started, release), fdk.WithHTTPServerConfig(fdk.HTTPServerConfig{
+			MaxInFlight:  1,
+			MaxQueue:     1,
+			QueueTimeout: time.Minute,
+		}))
+
+		codes := make(chan int, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				resp, _ := doReq(t, ctx, addr, "/block")
+				codes <- resp.StatusCode
+			}()
+		}
+		<-started
+		close(release)
+
+		fdk.EqualVals(t, http.StatusCreated, <-codes)
+		fdk.EqualVals(t, http.StatusCreated, <-codes)
+	})
+
+	t.Run("shed requests should be counted and logged", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		logFile, err := os.Create(filepath.Join(t.TempDir(), "fn.log"))
+		mustNoErr(t, err)
+		defer func() { _ = logFile.Close() }()
+
+		started, release := make(chan struct{}, 1), make(chan struct{})
+		addr := newServer(ctx, t, newHandler(started, release),
+			fdk.WithHTTPServerConfig(fdk.HTTPServerConfig{MaxInFlight: 1, QueueTimeout: 50 * time.Millisecond}),
+			fdk.WithMetricsConfig(fdk.MetricsConfig{Route: "/metrics"}),
+			fdk.WithAccessLog(fdk.AccessLogConfig{FailuresOnly: true}),
+			fdk.WithLoggerConfig(fdk.LoggerConfig{Output: logFile}),
+		)
+
+		inFlight := make(chan int, 1)
+		go func() {
+			resp, _ := doReq(t, ctx, addr, "/block")
+			inFlight <- resp.StatusCode
+		}()
+		<-started
+
+		resp, _ := doReq(t, ctx, addr, "/block")
+		fdk.EqualVals(t, http.StatusTooManyRequests, resp.StatusCode)
+
+		close(release)
+		fdk.EqualVals(t, http.StatusCreated, <-inFlight)
+
+		metricsResp, err := http.Get(addr + "/metrics")
+		mustNoErr(t, err)
+		defer func() { _ = metricsResp.Body.Close() }()
+		b, err := io.ReadAll(metricsResp.Body)
+		mustNoErr(t, err)
+		metrics := string(b)
+		for _, want := range []string{
+			`fn_requests_total{route="",method="GET",status_class="4xx"} 1`,
+			`fn_response_errors_total{route="",method="GET",code="429"} 1`,
+		} {
+			fdk.EqualVals(t, true, strings.Contains(metrics, want), "missing metric line: %s", want)
+		}
+
+		accessLogs := readLogLines(t, logFile.Name(), "request handled")
+		if fdk.EqualVals(t, 1, len(accessLogs)) {
+			fdk.EqualVals(t, logLine{Msg: "request handled", Method: http.MethodGet, Status: http.StatusTooManyRequests}, accessLogs[0])
+		}
+	})
+
+	t.Run("health routes should bypass the limit of a saturated runner", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		started, release := make(chan struct{}, 1), make(chan struct{})
+		addr := newServer(ctx, t, newHandler(started, release), fdk.WithHTTPServerConfig(fdk.HTTPServerConfig{
+			MaxInFlight:  1,
+			QueueTimeout: 50 * time.Millisecond,
+		}))
+
+		inFlight := make(chan int, 1)
+		go func() {
+			resp, _ := doReq(t, ctx, addr, "/block")
+			inFlight <- resp.StatusCode
+		}()
+		<-started
+
+		resp, _ := doReq(t, ctx, addr, "/block")
+		fdk.EqualVals(t, http.StatusTooManyRequests, resp.StatusCode)
+
+		for _, route := range []string{"/healthz", "/livez", "/readyz"} {
+			resp, got := doReq(t, ctx, addr, route)
+			fdk.EqualVals(t, http.StatusOK, resp.StatusCode, "route: %s", route)
+			fdk.EqualVals(t, http.StatusOK, got.Code, "route: %s", route)
+		}
+
+		close(release)
+		fdk.EqualVals(t, http.StatusCreated, <-inFlight)
+	})
+
+	t.Run("healthz should report the requests in flight", func(t *testing.T) {
+		t.Setenv("CS_HTTP_MAX_IN_FLIGHT", "5")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		addr := newServer(ctx, t, newHandler(nil, nil))
+
+		b, err := json.Marshal(map[string]string{"method": http.MethodGet, "url": "/healthz"})
+		mustNoErr(t, err)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, bytes.NewBuffer(b))
+		mustNoErr(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		mustNoErr(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		var got struct {
+			Body map[string]string `json:"body"`
+		}
+		decodeBody(t, resp.Body, &got)
+
+		fdk.EqualVals(t, "0", got.Body["in_flight"])
+		fdk.EqualVals(t, "0", got.Body["queued"])
+		fdk.EqualVals(t, "5", got.Body["max_in_flight"])
+	})
+}
+
+func TestRun_gracefulDrain(t *testing.T) {
+	doReq := func(ctx context.Context, addr, url string) (respBody, error) {
+		b, err := json.Marshal(map[string]string{"method": http.MethodGet, "url": url})
+		if err != nil {
+			return respBody{}, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, bytes.NewBuffer(b))
+		if err != nil {
+			return respBody{}, err
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return respBody{}, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		var got respBody
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		return got, err
+	}
+
+	type server struct {
+		addr    string
+		done    chan struct{}
+		started chan struct{}
+		release chan struct{}
+
+		mu    sync.Mutex
+		hooks []string
+	}
+	start := func(t *testing.T, ctx context.Context, cfg fdk.HTTPServerConfig) *server {
+		t.Helper()
+
+		port := newIP(t)
+		t.Setenv("PORT", port)
+
+		srv := &server{
+			addr:    "http://localhost:" + port,
+			done:    make(chan struct{}),
+			started: make(chan struct{}, 1),
+			release: make(chan struct{}),
+		}
+		hook := func(name string) func(context.Context) error {
+			return func(context.Context) error {
+				srv.mu.Lock()
+				defer srv.mu.Unlock()
+				srv.hooks = append(srv.hooks, name)
+				return nil
+			}
+		}
+
+		go func() {
+			defer close(srv.done)
+			fdk.Run(ctx, func(ctx context.Context, _ *slog.Logger, _ fdk.SkipCfg) fdk.Handler {
+				fdk.OnShutdown(ctx, "constructor hook", hook("constructor hook"))
+
+				m := fdk.NewMux()
+				m.Get("/slow", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+					srv.started <- struct{}{}
+					<-srv.release
+					return fdk.Response{Code: http.StatusCreated}
+				}))
+				return m
+			}, fdk.WithHTTPServerConfig(cfg), fdk.WithShutdownHook("option hook", hook("option hook")))
+		}()
+
+		waitForServer(t, "localhost:"+port)
+		return srv
+	}
+
+	t.Run("should flip readiness, wait on requests in flight, and run shutdown hooks", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		srv := start(t, ctx, fdk.HTTPServerConfig{DrainDelay: 200 * time.Millisecond, ShutdownTimeout: 5 * time.Second})
+
+		got, err := doReq(context.Background(), srv.addr, "/readyz")
+		mustNoErr(t, err)
+		fdk.EqualVals(t, http.StatusOK, got.Code)
+
+		slow := make(chan respBody, 1)
+		go func() {
+			got, _ := doReq(context.Background(), srv.addr, "/slow")
+			slow <- got
+		}()
+		<-srv.started
+
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+
+		got, err = doReq(context.Background(), srv.addr, "/readyz")
+		mustNoErr(t, err)
+		fdk.EqualVals(t, http.StatusServiceUnavailable, got.Code)
+		if fdk.EqualVals(t, 1, len(got.Errs)) {
+			fdk.EqualVals(t, fdk.APIError{Code: http.StatusServiceUnavailable, Message: "function is draining"}, got.Errs[0])
+		}
+
+		select {
+		case <-srv.done:
+			t.Fatal("run returned with a request in flight")
+		case <-time.After(300 * time.Millisecond):
+		}
+
+		close(srv.release)
+		fdk.EqualVals(t, http.StatusCreated, (<-slow).Code)
+
+		select {
+		case <-srv.done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("run did not return once requests in flight completed")
+		}
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		if fdk.EqualVals(t, 2, len(srv.hooks)) {
+			fdk.EqualVals(t, "constructor hook", srv.hooks[0])
+			fdk.EqualVals(t, "option hook", srv.hooks[1])
+		}
+	})
+
+	t.Run("should cut off requests in flight past the shutdown timeout", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		srv := start(t, ctx, fdk.HTTPServerConfig{ShutdownTimeout: 50 * time.Millisecond})
+		defer close(srv.release)
+
+		slow := make(chan error, 1)
+		go func() {
+			_, err := doReq(context.Background(), srv.addr, "/slow")
+			slow <- err
+		}()
+		<-srv.started
+
+		cancel()
+
+		select {
+		case <-srv.done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("run did not return after the shutdown timeout")
+		}
+		if err := <-slow; err == nil {
+			t.Error("expected the request in flight to be cut off")
+		}
+
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		fdk.EqualVals(t, 2, len(srv.hooks))
+	})
+}
+
+func TestRun_tracing(t *testing.T) {
+	type upstreamReq struct {
+		traceparent string
+	}
+
+	start := func(t *testing.T) (string, *tracetest.InMemoryExporter, <-chan upstreamReq) {
+		t.Helper()
+
+		upstreamReqs := make(chan upstreamReq, 1)
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			upstreamReqs <- upstreamReq{traceparent: req.Header.Get("Traceparent")}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		t.Cleanup(upstream.Close)
+
+		outFile := filepath.Join(t.TempDir(), "out.txt")
+		newHandler := func(ctx context.Context, _ *slog.Logger, _ fdk.SkipCfg) fdk.Handler {
+			client := &http.Client{Transport: fdk.TracingTransport(nil)}
+
+			m := fdk.NewMux()
+			m.Post("/people/{id}", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL+"/detects", nil)
+				if err != nil {
+					return fdk.ErrResp(fdk.APIError{Code: http.StatusInternalServerError, Message: err.Error()})
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					return fdk.ErrResp(fdk.APIError{Code: http.StatusBadGateway, Message: err.Error()})
+				}
+				_ = resp.Body.Close()
+
+				return fdk.Response{
+					Code: http.StatusCreated,
+					Body: fdk.File{
+						ContentType: "text/plain",
+						Filename:    outFile,
+						Contents:    io.NopCloser(strings.NewReader("contents")),
+					},
+				}
+			}))
+			return m
+		}
+
+		exp := tracetest.NewInMemoryExporter()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+
+		addr := newServer(ctx, t, newHandler, fdk.WithTracerProvider(tp))
+		return addr, exp, upstreamReqs
+	}
+
+	doReq := func(t *testing.T, addr string, traceID string, headers http.Header) {
+		t.Helper()
+
+		b, err := json.Marshal(map[string]any{
+			"method":   http.MethodPost,
+			"url":      "/people/frodo",
+			"trace_id": traceID,
+			"header":   headers,
+		})
+		mustNoErr(t, err)
+
+		resp, err := http.Post(addr, "application/json", bytes.NewBuffer(b))
+		mustNoErr(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		var got respBody
+		decodeBody(t, resp.Body, &got)
+		fdk.EqualVals(t, http.StatusCreated, got.Code)
+	}
+
+	// the invocation span ends once the response is written, so may land after the response
+	spansByName := func(t *testing.T, exp *tracetest.InMemoryExporter) map[string]tracetest.SpanStub {
+		t.Helper()
+
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			out := make(map[string]tracetest.SpanStub)
+			for _, s := range exp.GetSpans() {
+				out[s.Name] = s
+			}
+			if _, ok := out["fn.invoke"]; ok || time.Now().After(deadline) {
+				return out
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	attrOf := func(s tracetest.SpanStub, key string) string {
+		for _, kv := range s.Attributes {
+			if string(kv.Key) == key {
+				return kv.Value.Emit()
+			}
+		}
+		return ""
+	}
+
+	t.Run("should trace the invocation with the envelope trace ID and propagate it to outbound calls", func(t *testing.T) {
+		addr, exp, upstreamReqs := start(t)
+
+		doReq(t, addr, "4bf92f35-77b3-4da6-a3ce-929d0e0e4736", nil)
+
+		spans := spansByName(t, exp)
+		for _, name := range []string{"fn.config.load", "fn.handler.build", "fn.invoke", "fn.mux.dispatch", "HTTP GET", "fn.file.write"} {
+			if _, ok := spans[name]; !ok {
+				t.Fatalf("missing span: %s", name)
+			}
+		}
+
+		invoke := spans["fn.invoke"]
+		fdk.EqualVals(t, "4bf92f3577b34da6a3ce929d0e0e4736", invoke.SpanContext.TraceID().String())
+		fdk.EqualVals(t, trace.SpanKindServer, invoke.SpanKind)
+		fdk.EqualVals(t, "4bf92f35-77b3-4da6-a3ce-929d0e0e4736", attrOf(invoke, "fn.trace_id"))
+		fdk.EqualVals(t, "201", attrOf(invoke, "http.response.status_code"))
+
+		dispatch := spans["fn.mux.dispatch"]
+		fdk.EqualVals(t, invoke.SpanContext.SpanID(), dispatch.Parent.SpanID())
+		fdk.EqualVals(t, "/people/{id}", attrOf(dispatch, "http.route"))
+
+		outbound := spans["HTTP GET"]
+		fdk.EqualVals(t, dispatch.SpanContext.SpanID(), outbound.Parent.SpanID())
+		fdk.EqualVals(t, trace.SpanKindClient, outbound.SpanKind)
+		fdk.EqualVals(t, "204", attrOf(outbound, "http.response.status_code"))
+
+		upstream := <-upstreamReqs
+		want := "00-" + outbound.SpanContext.TraceID().String() + "-" + outbound.SpanContext.SpanID().String() + "-01"
+		fdk.EqualVals(t, want, upstream.traceparent)
+
+		file := spans["fn.file.write"]
+		fdk.EqualVals(t, invoke.SpanContext.SpanID(), file.Parent.SpanID())
+		fdk.EqualVals(t, "8", attrOf(file, "file.size"))
+	})
+
+	t.Run("should continue the trace context of the envelope headers", func(t *testing.T) {
+		addr, exp, upstreamReqs := start(t)
+
+		headers := http.Header{"Traceparent": []string{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}}
+		doReq(t, addr, "not-a-trace-id", headers)
+		<-upstreamReqs
+
+		invoke := spansByName(t, exp)["fn.invoke"]
+		fdk.EqualVals(t, "0af7651916cd43dd8448eb211c80319c", invoke.SpanContext.TraceID().String())
+		fdk.EqualVals(t, "b7ad6b7169203331", invoke.Parent.SpanID().String())
+		fdk.EqualVals(t, "not-a-trace-id", attrOf(invoke, "fn.trace_id"))
+	})
+}
+
+func TestRun_metrics(t *testing.T) {
+	newHandler := func(ctx context.Context, _ *slog.Logger, _ fdk.SkipCfg) fdk.Handler {
+		lookups := fdk.MetricsFrom(ctx).Counter("people_lookups_total", "People looked up by source.", "source")
+
+		m := fdk.NewMux()
+		m.Get("/people/{id}", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+			lookups.Inc("cache")
+			return fdk.Response{Code: http.StatusOK}
+		}))
+		m.Post("/boom", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+			panic("boom")
+		}))
+		outFile := filepath.Join(t.TempDir(), "out.txt")
+		m.Get("/file", fdk.HandlerFn(func(ctx context.Context, r fdk.Request) fdk.Response {
+			return fdk.Response{Body: fdk.File{
+				ContentType: "text/plain",
+				Filename:    outFile,
+				Contents:    io.NopCloser(strings.NewReader("contents")),
+			}}
+		}))
+		return m
+	}
+
+	doReq := func(t *testing.T, addr, method, url string) {
+		t.Helper()
+
+		b, err := json.Marshal(map[string]string{"method": method, "url": url})
+		mustNoErr(t, err)
+
+		resp, err := http.Post(addr, "application/json", bytes.NewBuffer(b))
+		mustNoErr(t, err)
+		_ = resp.Body.Close()
+	}
+
+	scrape := func(t *testing.T, addr string) string {
+		t.Helper()
+
+		resp, err := http.Get(addr)
+		mustNoErr(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		fdk.EqualVals(t, http.StatusOK, resp.StatusCode)
+		fdk.EqualVals(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+
+		b, err := io.ReadAll(resp.Body)
+		mustNoErr(t, err)
+		return string(b)
+	}
+
+	containsLines := func(t *testing.T, got string, want ...string) {
+		t.Helper()
+
+		lines := make(map[string]bool)
+		for _, line := range strings.Split(got, "\n") {
+			lines[line] = true
+		}
+		for _, w := range want {
+			if !lines[w] {
+				t.Errorf("missing metric line: %s", w)
+			}
+		}
+	}
+
+	exercise := func(t *testing.T, addr string) {
+		t.Helper()
+
+		doReq(t, addr, http.MethodGet, "/people/frodo")
+		doReq(t, addr, http.MethodGet, "/people/sam")
+		doReq(t, addr, http.MethodPost, "/boom")
+		doReq(t, addr, http.MethodGet, "/missing")
+		doReq(t, addr, http.MethodGet, "/file")
+	}
+
+	wantLines := []string{
+		`fn_requests_total{route="/people/{id}",method="GET",status_class="2xx"} 2`,
+		`fn_requests_total{route="/boom",method="POST",status_class="5xx"} 1`,
+		`fn_requests_total{route="",method="GET",status_class="4xx"} 1`,
+		`fn_response_errors_total{route="/boom",method="POST",code="503"} 1`,
+		`fn_response_errors_total{route="",method="GET",code="404"} 1`,
+		`fn_panics_total 1`,
+		`fn_request_duration_seconds_count{route="/people/{id}",method="GET"} 2`,
+		`fn_request_size_bytes_count{route="/people/{id}",method="GET"} 2`,
+		`fn_response_size_bytes_count{route="/people/{id}",method="GET"} 2`,
+		`fn_file_size_bytes_sum{route="/file",method="GET"} 8`,
+		`fn_file_size_bytes_count{route="/file",method="GET"} 1`,
+		`people_lookups_total{source="cache"} 2`,
+	}
+
+	t.Run("with a metrics route should serve the metrics alongside the invocations", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		addr := newServer(ctx, t, newHandler, fdk.WithMetricsConfig(fdk.MetricsConfig{Route: "/metrics"}))
+		exercise(t, addr)
+
+		containsLines(t, scrape(t, addr+"/metrics"), wantLines...)
+	})
+
+	t.Run("with a metrics address should serve the metrics on a separate port", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		metricsAddr := "localhost:" + newIP(t)
+		t.Setenv("CS_METRICS_ADDR", metricsAddr)
+
+		addr := newServer(ctx, t, newHandler)
+		waitForServer(t, metricsAddr)
+		exercise(t, addr)
+
+		containsLines(t, scrape(t, "http://"+metricsAddr+"/metrics"), wantLines...)
+	})
+}
+
+func TestRun_invalidEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		opts      []fdk.RunOpt
+		wantPanic string
+	}{
+		{
+			name:      "HTTP server",
+			env:       map[string]string{"CS_HTTP_READ_TIMEOUT": "soon"},
+			wantPanic: `invalid CS_HTTP_READ_TIMEOUT provided: "soon"`,
+		},
+		{
+			name:      "unix socket mode",
+			env:       map[string]string{"CS_HTTP_UNIX_SOCKET": filepath.Join(t.TempDir(), "fn.sock"), "CS_HTTP_UNIX_SOCKET_MODE": "rw"},
+			wantPanic: `invalid CS_HTTP_UNIX_SOCKET_MODE provided: "rw"`,
+		},
+		{
+			name:      "metrics",
+			env:       map[string]string{"CS_METRICS_ROUTE": "metrics"},
+			wantPanic: `invalid metrics route provided, must be a path other than /: "metrics"`,
+		},
+		{
+			name:      "logger",
+			env:       map[string]string{"CS_LOG_LEVEL": "loud"},
+			wantPanic: `invalid CS_LOG_LEVEL provided: "loud"`,
+		},
+		{
+			name:      "handler timeout",
+			env:       map[string]string{"CS_FN_TIMEOUT": "0s"},
+			wantPanic: `invalid CS_FN_TIMEOUT provided: "0s"`,
+		},
+		{
+			name:      "shutdown hooks",
+			env:       map[string]string{"CS_FN_SHUTDOWN_HOOKS_TIMEOUT": "-1s"},
+			wantPanic: `invalid CS_FN_SHUTDOWN_HOOKS_TIMEOUT provided: "-1s"`,
+		},
+		{
+			name:      "capture",
+			env:       map[string]string{"CS_CAPTURE_FILE": filepath.Join(t.TempDir(), "capture.jsonl"), "CS_CAPTURE_MAX_BYTES": "lots"},
+			wantPanic: `invalid CS_CAPTURE_MAX_BYTES provided: "lots"`,
+		},
+		{
+			name:      "access log",
+			env:       map[string]string{"CS_ACCESS_LOG": "yes please"},
+			wantPanic: `invalid CS_ACCESS_LOG provided: "yes please"`,
+		},
+		{
+			name:      "config reload",
+			env:       map[string]string{"CS_FN_CONFIG_POLL_INTERVAL": "often"},
+			opts:      []fdk.RunOpt{fdk.WithConfigReload()},
+			wantPanic: `failed to watch config for changes: invalid CS_FN_CONFIG_POLL_INTERVAL provided: "often"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfigFile(t, `{"string": "val","integer": 1}`, "")
+			t.Setenv("PORT", newIP(t))
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			defer func() {
+				got, _ := recover().(string)
+				fdk.EqualVals(t, tt.wantPanic, got)
+			}()
+
+			fdk.Run(context.Background(), func(ctx context.Context, _ *slog.Logger, cfg config) fdk.Handler {
+				m := fdk.NewMux()
+				m.Get("/path", newSimpleHandler(cfg))
+				return m
+			}, tt.opts...)
+		})
+	}
+}
+
 type config struct {
 	Err bool   `json:"err"`
 	Str string `json:"string"`
@@ -1283,7 +2613,7 @@ func newJSONBodyHandler(cfg config) fdk.Handler {
 }
 
 func newEchoResp(ctx context.Context, cfg config, r fdk.Request) fdk.Response {
-	traceID, _ := ctx.Value("_traceid").(string)
+	traceID := fdk.TraceIDFrom(ctx)
 	bodyB, _ := io.ReadAll(r.Body)
 	return fdk.Response{
 
@@ -1513,32 +2843,38 @@ func decodeJSON(t testing.TB, b []byte, v any) {
 	}
 }
 
-func newServer[CFG fdk.Cfg](ctx context.Context, t *testing.T, newHandlerFn func(context.Context, *slog.Logger, CFG) fdk.Handler) string {
+func newServer[CFG fdk.Cfg](ctx context.Context, t *testing.T, newHandlerFn func(context.Context, *slog.Logger, CFG) fdk.Handler, opts ...fdk.RunOpt) string {
 	t.Helper()
 
 	port := newIP(t)
 	t.Setenv("PORT", port)
 
-	readyChan := make(chan struct{})
-
 	done := make(chan struct{})
 	go func() {
 		defer close(done)
-		fdk.Run(ctx, func(ctx context.Context, logger *slog.Logger, cfg CFG) fdk.Handler {
-			h := newHandlerFn(ctx, logger, cfg)
-			close(readyChan)
-			return h
-		})
+		fdk.Run(ctx, newHandlerFn, opts...)
 	}()
 
-	select {
-	case <-readyChan:
-	case <-time.After(200 * time.Millisecond):
-	}
+	waitForServer(t, "localhost:"+port)
 
 	return "http://localhost:" + port
 }
 
+func waitForServer(t *testing.T, addr string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			_ = conn.Close()
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("server did not start listening on %s", addr)
+}
+
 func newIP(t *testing.T) string {
 	t.Helper()
 
@@ -1555,6 +2891,34 @@ func newIP(t *testing.T) string {
 	return parts[len(parts)-1]
 }
 
+type logLine struct {
+	Msg    string `json:"msg"`
+	Err    string `json:"err"`
+	Method string `json:"method"`
+	Status int    `json:"status"`
+}
+
+// readLogLines reads the JSON logs written to the file, returning those with the msg.
+func readLogLines(t *testing.T, filename, msg string) []logLine {
+	t.Helper()
+
+	b, err := os.ReadFile(filename)
+	mustNoErr(t, err)
+
+	var out []logLine
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if line == "" {
+			continue
+		}
+		var l logLine
+		mustNoErr(t, json.Unmarshal([]byte(line), &l))
+		if l.Msg == msg {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
 func writeConfigFile(t *testing.T, config, cfgFile string) {
 	t.Helper()
 
@@ -0,0 +1,152 @@
+package fdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/CrowdStrike/foundry-fn-go/jsonschema"
+)
+
+// SchemaOpt configures the behavior of the SchemaValidator middleware.
+type SchemaOpt func(*schemaOpts)
+
+type schemaOpts struct {
+	logger          *slog.Logger
+	enforceResponse bool
+}
+
+// WithSchemaLogger sets the logger used to report response schema violations. The
+// slog.Default logger is used when not provided.
+func WithSchemaLogger(logger *slog.Logger) SchemaOpt {
+	return func(o *schemaOpts) {
+		o.logger = logger
+	}
+}
+
+// WithResponseSchemaEnforced fails a response that does not satisfy the response schema
+// with a 500 error. By default, the violations are logged and the response is returned
+// unchanged.
+func WithResponseSchemaEnforced() SchemaOpt {
+	return func(o *schemaOpts) {
+		o.enforceResponse = true
+	}
+}
+
+// SchemaValidator creates middleware that validates the request body against the request
+// schema and the response body against the response schema. An empty schema skips its
+// validation. A request that does not satisfy the schema receives a 400 error for each
+// violation and the handler is not called. The request body is buffered once, so handlers
+// created with HandleFnOf receive the same body. Responses with errors or a File body
+// are not validated.
+func SchemaValidator(reqSchema, respSchema string, opts ...SchemaOpt) (Middleware, error) {
+	o := schemaOpts{logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var reqValidator, respValidator *jsonschema.Validator
+	if reqSchema != "" {
+		v, err := jsonschema.NewValidator(reqSchema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request schema: %w", err)
+		}
+		reqValidator = v
+	}
+	if respSchema != "" {
+		v, err := jsonschema.NewValidator(respSchema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response schema: %w", err)
+		}
+		respValidator = v
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFn(func(ctx context.Context, r Request) Response {
+			if reqValidator != nil {
+				body, errs := validateReqBody(reqValidator, &r)
+				if len(errs) > 0 {
+					return ErrResp(errs...)
+				}
+				if body != nil {
+					r.Body = body
+				}
+			}
+
+			resp := next.Handle(ctx, r)
+
+			if respValidator == nil || len(resp.Errors) > 0 || resp.Body == nil {
+				return resp
+			}
+			if _, ok := resp.Body.(File); ok {
+				return resp
+			}
+
+			err := validateRespBody(respValidator, resp.Body)
+			if err == nil {
+				return resp
+			}
+
+			o.logger.Error("response body failed schema validation", "url", r.URL, "method", r.Method, "err", err)
+			if o.enforceResponse {
+				return ErrResp(APIError{Code: http.StatusInternalServerError, Message: "response failed schema validation"})
+			}
+			return resp
+		})
+	}, nil
+}
+
+// validateReqBody validates the request body, returning the buffered body to replace the
+// consumed request body with.
+func validateReqBody(v *jsonschema.Validator, r *Request) (io.Reader, []APIError) {
+	var (
+		b    []byte
+		body io.Reader
+	)
+	switch rb := r.Body.(type) {
+	case *ComplexPayload:
+		b = rb.Body
+	case nil:
+	default:
+		var err error
+		b, err = io.ReadAll(rb)
+		if err != nil {
+			return nil, []APIError{{Code: http.StatusBadRequest, Message: "failed to read payload: " + err.Error()}}
+		}
+		body = bytes.NewReader(b)
+	}
+	if len(b) == 0 {
+		b = []byte("null")
+	}
+
+	err := v.Validate(b)
+	var ve *jsonschema.ValidationError
+	switch {
+	case errors.As(err, &ve):
+		errs := make([]APIError, 0, len(ve.Violations))
+		for _, violation := range ve.Violations {
+			errs = append(errs, APIError{
+				Code:    http.StatusBadRequest,
+				Message: "request body failed schema validation at " + violation.String(),
+			})
+		}
+		return nil, errs
+	case err != nil:
+		return nil, []APIError{{Code: http.StatusBadRequest, Message: "failed to unmarshal payload: " + err.Error()}}
+	}
+
+	return body, nil
+}
+
+func validateRespBody(v *jsonschema.Validator, body json.Marshaler) error {
+	b, err := body.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal response body: %w", err)
+	}
+	return v.Validate(b)
+}
@@ -0,0 +1,146 @@
+package fdk_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/CrowdStrike/foundry-fn-go/fdktest"
+)
+
+func TestSchemaValidator(t *testing.T) {
+	reqSchema := `{
+  "type": "object",
+  "properties": {
+    "name": {"type": "string", "minLength": 1},
+    "age": {"type": "integer", "minimum": 0}
+  },
+  "required": ["name"]
+}`
+	respSchema := `{
+  "type": "object",
+  "properties": {
+    "greeting": {"type": "string"}
+  },
+  "required": ["greeting"]
+}`
+
+	type greetReq struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	newHandler := func(respBody any) fdk.Handler {
+		return fdk.HandleFnOf(func(ctx context.Context, r fdk.RequestOf[greetReq]) fdk.Response {
+			if respBody == nil {
+				respBody = map[string]string{"greeting": "hello " + r.Body.Name}
+			}
+			return fdk.Response{Code: http.StatusOK, Body: fdk.JSON(respBody)}
+		})
+	}
+
+	tests := []struct {
+		name     string
+		opts     []fdk.SchemaOpt
+		respBody any
+		body     string
+		want     []fdktest.WantFn
+	}{
+		{
+			name: "valid request should reach handler with the body intact",
+			body: `{"name": "frodo", "age": 50}`,
+			want: []fdktest.WantFn{
+				fdktest.WantNoErrs(),
+				fdktest.WantCode(http.StatusOK),
+				wantBody(`{"greeting":"hello frodo"}`),
+			},
+		},
+		{
+			name: "invalid request should fail with an error per violation",
+			body: `{"name": "", "age": -1}`,
+			want: []fdktest.WantFn{
+				fdktest.WantCode(http.StatusBadRequest),
+				wantErrsUnordered(
+					fdk.APIError{Code: http.StatusBadRequest, Message: `request body failed schema validation at "#/name": length must be >= 1, but got 0`},
+					fdk.APIError{Code: http.StatusBadRequest, Message: `request body failed schema validation at "#/age": must be >= 0 but found -1`},
+				),
+			},
+		},
+		{
+			name: "malformed request should fail",
+			body: `{"name":`,
+			want: []fdktest.WantFn{
+				fdktest.WantCode(http.StatusBadRequest),
+			},
+		},
+		{
+			name:     "invalid response should be returned when not enforced",
+			body:     `{"name": "frodo"}`,
+			respBody: map[string]int{"greeting": 1},
+			want: []fdktest.WantFn{
+				fdktest.WantNoErrs(),
+				fdktest.WantCode(http.StatusOK),
+				wantBody(`{"greeting":1}`),
+			},
+		},
+		{
+			name:     "invalid response should fail when enforced",
+			opts:     []fdk.SchemaOpt{fdk.WithResponseSchemaEnforced()},
+			body:     `{"name": "frodo"}`,
+			respBody: map[string]int{"greeting": 1},
+			want: []fdktest.WantFn{
+				fdktest.WantCode(http.StatusInternalServerError),
+				fdktest.WantErrs(fdk.APIError{Code: http.StatusInternalServerError, Message: "response failed schema validation"}),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]fdk.SchemaOpt{fdk.WithSchemaLogger(fdktest.NewLogger(t))}, tt.opts...)
+			mw, err := fdk.SchemaValidator(reqSchema, respSchema, opts...)
+			mustNoErr(t, err)
+
+			h := mw(newHandler(tt.respBody))
+			resp := h.Handle(context.TODO(), fdk.Request{Method: http.MethodPost, URL: "/", Body: strings.NewReader(tt.body)})
+
+			fdktest.Want(t, resp, tt.want...)
+		})
+	}
+
+	t.Run("invalid schema should error", func(t *testing.T) {
+		_, err := fdk.SchemaValidator(`{"type": 1}`, "")
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func wantBody(want string) fdktest.WantFn {
+	return func(t *testing.T, got fdk.Response) {
+		t.Helper()
+
+		b, err := got.Body.MarshalJSON()
+		mustNoErr(t, err)
+		fdk.EqualVals(t, want, string(b))
+	}
+}
+
+func wantErrsUnordered(wants ...fdk.APIError) fdktest.WantFn {
+	return func(t *testing.T, got fdk.Response) {
+		t.Helper()
+
+		gotErrs := make(map[fdk.APIError]bool)
+		for _, e := range got.Errors {
+			gotErrs[e] = true
+		}
+		fdk.EqualVals(t, len(wants), len(got.Errors))
+		for _, want := range wants {
+			if !gotErrs[want] {
+				t.Errorf("missing error:\n\twant:\t%+v\n\tgot:\t%+v", want, got.Errors)
+			}
+		}
+	}
+}
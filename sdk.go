@@ -3,8 +3,13 @@ package fdk
 import (
 	"context"
 	"log/slog"
+	"net"
 	"net/http"
+	"os"
 	"runtime/debug"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Handler provides a handler for our incoming request.
@@ -12,34 +17,199 @@ type Handler interface {
 	Handle(ctx context.Context, r Request) Response
 }
 
-// Run is the meat and potatoes. This is the entrypoint for everything.
-func Run[T Cfg](ctx context.Context, newHandlerFn func(context.Context, *slog.Logger, T) Handler) {
-	run(ctx, func(ctx context.Context, logger *slog.Logger) Handler {
-		var runFn Handler = HandlerFn(func(ctx context.Context, r Request) Response {
-			cfg, loadErr := readCfg[T](ctx)
-			if loadErr != nil {
-				if loadErr.err != nil {
-					logger.Error("failed to load config", "err", loadErr.err)
-				}
-				return ErrResp(loadErr.apiErr)
-			}
+// RunOpt configures the behavior of Run.
+type RunOpt func(*runOpts)
 
-			h := newHandlerFn(ctx, logger, cfg)
+type runOpts struct {
+	perRequest bool
+	reload     bool
 
-			return h.Handle(ctx, r)
-		})
+	listener       net.Listener
+	unixSocket     string
+	unixSocketMode os.FileMode
+	httpServer     HTTPServerConfig
+	handlerTimeout time.Duration
+	shutdownHooks  []shutdownHook
+	tracerProvider trace.TracerProvider
+	metrics        MetricsConfig
+	logger         LoggerConfig
+	logHandler     func(slog.Handler) slog.Handler
+	accessLog      *AccessLogConfig
+}
+
+// WithHandlerPerRequest opts into loading the config and constructing the handler
+// on every request. By default, the config is loaded and the handler is built once
+// at startup and reused for all requests. This is only useful for functions that
+// genuinely need a fresh handler per invocation.
+func WithHandlerPerRequest() RunOpt {
+	return func(o *runOpts) {
+		o.perRequest = true
+	}
+}
+
+// WithConfigReload opts into reloading the config at runtime. When the config loader
+// implements ConfigWatcher, a change to the config is loaded, validated, and a newly
+// built handler is swapped in atomically. In-flight requests finish on the previous
+// handler. A config that fails to load or validate is logged and the last good handler
+// continues to serve requests. A watcher that fails to start, i.e. with an invalid
+// CS_FN_CONFIG_POLL_INTERVAL, panics. This option has no effect with
+// WithHandlerPerRequest, which always loads the latest config.
+func WithConfigReload() RunOpt {
+	return func(o *runOpts) {
+		o.reload = true
+	}
+}
+
+// WithListener serves the HTTP runner on the provided listener instead of the TCP
+// port. The listener is closed when the server shuts down. This takes precedence
+// over WithUnixSocket and the PORT env var.
+func WithListener(l net.Listener) RunOpt {
+	return func(o *runOpts) {
+		o.listener = l
+	}
+}
+
+// WithUnixSocket serves the HTTP runner on a Unix domain socket at the provided path
+// instead of the TCP port. The socket file is given the provided permission bits. A
+// stale socket file left behind by a previous process is removed. The socket may also
+// be set via the CS_HTTP_UNIX_SOCKET and CS_HTTP_UNIX_SOCKET_MODE env vars.
+func WithUnixSocket(path string, mode os.FileMode) RunOpt {
+	return func(o *runOpts) {
+		o.unixSocket = path
+		o.unixSocketMode = mode
+	}
+}
+
+// Run is the meat and potatoes. This is the entrypoint for everything. The config is
+// loaded and validated, the handler is constructed, and the runner selected by the
+// CS_RUNNER_TYPE env var serves it. When the config fails to load or validate, every
+// request is answered with the config error. Run is configured via the RunOpts and env
+// vars, an invalid value of which panics so that the function fails to start.
+func Run[T Cfg](ctx context.Context, newHandlerFn func(context.Context, *slog.Logger, T) Handler, opts ...RunOpt) {
+	var o runOpts
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.tracerProvider == nil {
+		tp, err := envTracerProvider()
+		if err != nil {
+			panic(err.Error())
+		}
+		if tp != nil {
+			o.tracerProvider = tp
+			// flushed last, after the hooks that may still create spans
+			o.shutdownHooks = append([]shutdownHook{{name: "flush traces", fn: tp.Shutdown}}, o.shutdownHooks...)
+		}
+	}
+
+	accessLog, err := accessLogCfg(o.accessLog)
+	if err != nil {
+		panic(err.Error())
+	}
+	o.accessLog = accessLog
+
+	hooksTimeout, err := shutdownHooksTimeout()
+	if err != nil {
+		panic(err.Error())
+	}
+	ctx, hooks := newShutdownHooks(ctx, hooksTimeout, o.shutdownHooks)
+	ctx = withMetrics(ctx, newMetrics())
+	ctx, exitCode := withExitCode(ctx)
+	hooksLogger := slog.Default()
+	defer func() {
+		hooks.run(hooksLogger)
+		if code := exitCode.Load(); code != 0 {
+			os.Exit(int(code))
+		}
+	}()
+
+	run(withRunOpts(ctx, o), func(ctx context.Context, logger *slog.Logger) Handler {
+		hooksLogger = logger
+		timeout, err := handlerTimeout(o)
+		if err != nil {
+			panic(err.Error())
+		}
+		capture := captureMiddleware(logger)
+
+		var runFn Handler
+		switch {
+		case o.perRequest:
+			runFn = HandlerFn(func(ctx context.Context, r Request) Response {
+				// the handler is released once the request it was built for completes
+				ctx, buildHooks := newShutdownHooks(ctx, hooksTimeout, nil)
+				defer buildHooks.run(logger)
+
+				h, _ := buildHandler(ctx, logger, newHandlerFn)
+				return h.Handle(ctx, r)
+			})
+		case o.reload:
+			runFn = newReloadHandler(ctx, logger, hooksTimeout, newHandlerFn)
+		default:
+			runFn, _ = buildHandler(ctx, logger, newHandlerFn)
+		}
+		runFn = withoutShutdownHooks(runFn)
 		runFn = recoverer(logger)(runFn)
+		runFn = deadliner(logger, timeout)(runFn)
+		runFn = capture(runFn)
 
 		return runFn
 	})
 }
 
-func recoverer(logger *slog.Logger) func(Handler) Handler {
+type ctxKeyRunOpts struct{}
+
+// withRunOpts makes the run options available to the runners, which share the
+// Runner signature with those registered through RegisterRunner.
+func withRunOpts(ctx context.Context, o runOpts) context.Context {
+	return context.WithValue(ctx, ctxKeyRunOpts{}, o)
+}
+
+func runOptsFrom(ctx context.Context) runOpts {
+	o, _ := ctx.Value(ctxKeyRunOpts{}).(runOpts)
+	return o
+}
+
+// buildHandler loads the config and constructs the handler from it. Any failure along
+// the way, including a panic from newHandlerFn, results in a handler that responds with
+// the appropriate errors alongside the error that caused it.
+func buildHandler[T Cfg](ctx context.Context, logger *slog.Logger, newHandlerFn func(context.Context, *slog.Logger, T) Handler) (h Handler, err error) {
+	loadCtx, loadSpan := startSpan(ctx, "fn.config.load")
+	cfg, loadErr := readCfg[T](loadCtx)
+	if loadErr != nil {
+		logger.Error("failed to load config", "err", loadErr.err)
+		endSpan(loadSpan, loadErr.apiErr)
+		return ErrHandler(loadErr.apiErr), loadErr.apiErr
+	}
+	endSpan(loadSpan, nil)
+
+	ctx, buildSpan := startSpan(ctx, "fn.handler.build")
+	defer func() { endSpan(buildSpan, err) }()
+
+	unexpectedErr := APIError{Code: http.StatusServiceUnavailable, Message: "encountered unexpected error"}
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("panic caught constructing handler", "stack_trace", string(debug.Stack()))
+			h, err = ErrHandler(unexpectedErr), unexpectedErr
+		}
+	}()
+
+	h = newHandlerFn(ctx, logger, cfg)
+	if h == nil {
+		logger.Error("handler constructor returned a nil handler")
+		return ErrHandler(unexpectedErr), unexpectedErr
+	}
+
+	return h, nil
+}
+
+func recoverer(logger *slog.Logger) Middleware {
 	return func(h Handler) Handler {
 		return HandlerFn(func(ctx context.Context, r Request) (resp Response) {
 			defer func() {
 				if err := recover(); err != nil {
 					logger.Error("panic caught", "stack_trace", string(debug.Stack()))
+					metricsFrom(ctx).recordPanic()
 					resp = ErrResp(APIError{Code: http.StatusServiceUnavailable, Message: "encountered unexpected error"})
 				}
 			}()
@@ -0,0 +1,221 @@
+package fdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithShutdownHook adds a hook that is run once the runner has stopped serving
+// requests, i.e. to flush telemetry or close connection pools. See OnShutdown for
+// hooks that depend on the handler.
+func WithShutdownHook(name string, fn func(ctx context.Context) error) RunOpt {
+	return func(o *runOpts) {
+		o.shutdownHooks = append(o.shutdownHooks, shutdownHook{name: name, fn: fn})
+	}
+}
+
+// OnShutdown adds a hook that releases the resources of a handler. The ctx must be the
+// one provided to the handler constructor given to Run, i.e.:
+//
+//	func newHandler(ctx context.Context, logger *slog.Logger, cfg config) fdk.Handler {
+//		db := openDB(cfg)
+//		fdk.OnShutdown(ctx, "close db", func(context.Context) error { return db.Close() })
+//		...
+//	}
+//
+// The hooks are tied to the handler built by the constructor call that added them. The
+// hooks of the handler built at startup are run once the runner has stopped serving
+// requests. With WithHandlerPerRequest, the hooks of a handler are run once the request
+// it was built for completes. With config reload, the hooks of a replaced handler are run
+// once the requests it is serving complete.
+//
+// Hooks run in the reverse order they were added, and share a budget of 15s, which may
+// be set via the CS_FN_SHUTDOWN_HOOKS_TIMEOUT env var. Outside of a handler constructor
+// called by Run, OnShutdown has no effect.
+func OnShutdown(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	hooks, ok := ctx.Value(ctxKeyShutdownHooks{}).(*shutdownHooks)
+	if !ok || hooks == nil {
+		return
+	}
+	hooks.add(shutdownHook{name: name, fn: fn})
+}
+
+type ctxKeyShutdownHooks struct{}
+
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+type shutdownHooks struct {
+	timeout time.Duration
+
+	mu    sync.Mutex
+	hooks []shutdownHook
+}
+
+// newShutdownHooks makes the hooks available to OnShutdown via the returned ctx. The
+// hooks share the provided budget when run.
+func newShutdownHooks(ctx context.Context, timeout time.Duration, hooks []shutdownHook) (context.Context, *shutdownHooks) {
+	h := &shutdownHooks{timeout: timeout, hooks: append([]shutdownHook(nil), hooks...)}
+	return context.WithValue(ctx, ctxKeyShutdownHooks{}, h), h
+}
+
+func (h *shutdownHooks) add(hook shutdownHook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = append(h.hooks, hook)
+}
+
+func (h *shutdownHooks) run(logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	h.runCtx(ctx, logger)
+}
+
+// shutdownHooksTimeout returns the budget shared by the hooks run together, 15s unless
+// set via the CS_FN_SHUTDOWN_HOOKS_TIMEOUT env var.
+func shutdownHooksTimeout() (time.Duration, error) {
+	v := os.Getenv("CS_FN_SHUTDOWN_HOOKS_TIMEOUT")
+	if v == "" {
+		return 15 * time.Second, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid CS_FN_SHUTDOWN_HOOKS_TIMEOUT provided: %q", v)
+	}
+	return d, nil
+}
+
+// runCtx runs the hooks within the budget of the provided ctx. The hooks are removed, so
+// that running them again has no effect.
+func (h *shutdownHooks) runCtx(ctx context.Context, logger *slog.Logger) {
+	h.mu.Lock()
+	hooks := h.hooks
+	h.hooks = nil
+	h.mu.Unlock()
+	if len(hooks) == 0 {
+		return
+	}
+
+	logger.Info(fmt.Sprintf("running %d shutdown hooks...", len(hooks)))
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hook := hooks[i]
+		if err := runShutdownHook(ctx, hook); err != nil {
+			logger.Error("shutdown hook failed", "hook", hook.name, "err", err)
+		}
+	}
+}
+
+// withoutShutdownHooks hides the shutdown hooks of the runner from the requests, so that
+// an OnShutdown call made with a request ctx does not add a hook for every request.
+func withoutShutdownHooks(next Handler) Handler {
+	return HandlerFn(func(ctx context.Context, r Request) Response {
+		return next.Handle(context.WithValue(ctx, ctxKeyShutdownHooks{}, (*shutdownHooks)(nil)), r)
+	})
+}
+
+func runShutdownHook(ctx context.Context, hook shutdownHook) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("shutdown hook panicked: %v", r)
+		}
+	}()
+	return hook.fn(ctx)
+}
+
+type ctxKeyDrainer struct{}
+
+// drainer tracks the requests in flight, so that the requests cut off by a shutdown
+// are accounted for, and flags when the runner is draining, so that readiness fails.
+type drainer struct {
+	draining atomic.Bool
+
+	mu       sync.Mutex
+	inFlight map[*inFlightReq]struct{}
+}
+
+type inFlightReq struct {
+	method  string
+	url     string
+	traceID string
+	start   time.Time
+}
+
+func newDrainer() *drainer {
+	return &drainer{inFlight: make(map[*inFlightReq]struct{})}
+}
+
+// isDraining reports whether the runner dispatching the request is draining.
+func isDraining(ctx context.Context) bool {
+	d, ok := ctx.Value(ctxKeyDrainer{}).(*drainer)
+	return ok && d.draining.Load()
+}
+
+func (d *drainer) track(next Handler) Handler {
+	return HandlerFn(func(ctx context.Context, r Request) Response {
+		req := &inFlightReq{method: r.Method, url: r.URL, traceID: r.TraceID, start: time.Now()}
+		d.mu.Lock()
+		d.inFlight[req] = struct{}{}
+		d.mu.Unlock()
+		defer func() {
+			d.mu.Lock()
+			delete(d.inFlight, req)
+			d.mu.Unlock()
+		}()
+
+		return next.Handle(context.WithValue(ctx, ctxKeyDrainer{}, d), r)
+	})
+}
+
+// shutdown drains the server. Readiness fails from the start of the drain. After the
+// drain delay, the server stops accepting requests and waits on the requests in flight
+// for up to the shutdown timeout, after which the remaining requests are cut off.
+func (d *drainer) shutdown(logger *slog.Logger, s *http.Server, cfg HTTPServerConfig) {
+	d.draining.Store(true)
+	if cfg.DrainDelay > 0 {
+		logger.Info("draining HTTP server, waiting on drain delay of " + cfg.DrainDelay.String())
+		time.Sleep(cfg.DrainDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	logger.Info("shutting down HTTP server...")
+	err := s.Shutdown(shutdownCtx)
+	if err == nil {
+		logger.Info("HTTP server shut down, all requests in flight completed")
+		return
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		logger.Error("failed to shutdown server", "err", err)
+	}
+
+	d.mu.Lock()
+	cutOff := make([]*inFlightReq, 0, len(d.inFlight))
+	for req := range d.inFlight {
+		cutOff = append(cutOff, req)
+	}
+	d.mu.Unlock()
+
+	logger.Warn(fmt.Sprintf("shutdown timeout of %s exceeded, cutting off %d requests in flight", cfg.ShutdownTimeout, len(cutOff)))
+	for _, req := range cutOff {
+		logger.Warn("request cut off by shutdown",
+			"method", req.method,
+			"url", req.url,
+			"trace_id", req.traceID,
+			"elapsed", time.Since(req.start).String(),
+		)
+	}
+	if err := s.Close(); err != nil {
+		logger.Error("failed to close server", "err", err)
+	}
+}
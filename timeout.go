@@ -0,0 +1,88 @@
+package fdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// WithHandlerTimeout sets the maximum duration of a single invocation of the handler.
+// The timeout may also be set via the CS_FN_TIMEOUT env var, i.e. 30s, an invalid value
+// of which panics at startup. The envelope of an invocation may carry an earlier
+// deadline, as an RFC 3339 timestamp in its deadline field or X-Cs-Deadline header. A
+// handler that overruns its deadline has its context cancelled, and the invocation is
+// answered with a 504 error.
+func WithHandlerTimeout(d time.Duration) RunOpt {
+	return func(o *runOpts) {
+		o.handlerTimeout = d
+	}
+}
+
+func handlerTimeout(o runOpts) (time.Duration, error) {
+	if o.handlerTimeout > 0 {
+		return o.handlerTimeout, nil
+	}
+
+	v := os.Getenv("CS_FN_TIMEOUT")
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid CS_FN_TIMEOUT provided: %q", v)
+	}
+	return d, nil
+}
+
+// deadliner enforces the deadline of the request context, as set by the timeout or the
+// invocation envelope. When the handler overruns its deadline, its context is cancelled
+// and a 504 is returned without waiting on the handler. The handler is left to observe
+// ctx.Done() and return, at which point its response is discarded. A response returned
+// once the deadline has passed is discarded as well.
+func deadliner(logger *slog.Logger, timeout time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFn(func(ctx context.Context, r Request) Response {
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			if _, ok := ctx.Deadline(); !ok {
+				return next.Handle(ctx, r)
+			}
+
+			respCh := make(chan Response, 1)
+			go func() {
+				respCh <- next.Handle(ctx, r)
+			}()
+
+			var resp Response
+			select {
+			case resp = <-respCh:
+			case <-ctx.Done():
+				if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					// the caller went away, there's no one to answer
+					return <-respCh
+				}
+				go func() { discardResp(<-respCh) }()
+			}
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return resp
+			}
+			discardResp(resp)
+
+			logger.Error("handler exceeded its deadline", "url", r.URL, "method", r.Method)
+			return ErrResp(APIError{Code: http.StatusGatewayTimeout, Message: "handler exceeded its deadline"})
+		})
+	}
+}
+
+func discardResp(resp Response) {
+	if f, ok := resp.Body.(File); ok && f.Contents != nil {
+		_ = f.Contents.Close()
+	}
+}
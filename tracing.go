@@ -0,0 +1,163 @@
+package fdk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/CrowdStrike/foundry-fn-go"
+
+// WithTracerProvider sets the OpenTelemetry tracer provider the spans of each invocation
+// are created with. The provider is not shut down by Run, add its Shutdown via
+// WithShutdownHook to flush the spans still buffered on exit. When not provided, the
+// CS_TRACES_EXPORTER env var may be set to console to write the spans to stderr, and
+// otherwise the global tracer provider is used, which does nothing until set via
+// otel.SetTracerProvider.
+func WithTracerProvider(tp trace.TracerProvider) RunOpt {
+	return func(o *runOpts) {
+		o.tracerProvider = tp
+	}
+}
+
+// envTracerProvider creates the tracer provider for the exporter set via the
+// CS_TRACES_EXPORTER env var. A nil provider is returned when the env var is unset.
+func envTracerProvider() (*sdktrace.TracerProvider, error) {
+	switch v := os.Getenv("CS_TRACES_EXPORTER"); v {
+	case "", "none":
+		return nil, nil
+	case "console":
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create console trace exporter: %w", err)
+		}
+		return sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp)), nil
+	default:
+		return nil, fmt.Errorf("invalid CS_TRACES_EXPORTER provided: %q", v)
+	}
+}
+
+// tracer returns the tracer for the ctx. Child spans are created from the provider of
+// their parent span, so that spans outside of Run, i.e. of a Mux under test, share the
+// provider of the caller.
+func tracer(ctx context.Context) trace.Tracer {
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		return span.TracerProvider().Tracer(tracerName)
+	}
+	if tp := runOptsFrom(ctx).tracerProvider; tp != nil {
+		return tp.Tracer(tracerName)
+	}
+	return otel.GetTracerProvider().Tracer(tracerName)
+}
+
+func startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracer(ctx).Start(ctx, name, opts...)
+}
+
+// endSpan ends the span, marking it as failed when an error is provided.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startInvokeSpan starts the server span of an invocation. The span continues the trace
+// of the W3C trace context in the envelope headers. Without one, an envelope trace ID
+// that is a valid trace ID, with or without dashes, is used as the trace ID of the span.
+func startInvokeSpan(ctx context.Context, r Request) (context.Context, trace.Span) {
+	t := tracer(ctx)
+
+	if sc := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(ctx, propagation.HeaderCarrier(r.Headers))); sc.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, sc)
+	} else if traceID, err := trace.TraceIDFromHex(strings.ReplaceAll(r.TraceID, "-", "")); err == nil {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID,
+			Remote:  true,
+		}))
+	}
+
+	return t.Start(ctx, "fn.invoke",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("fn.id", r.FnID),
+			attribute.Int("fn.version", r.FnVersion),
+			attribute.String("fn.trace_id", r.TraceID),
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL),
+		),
+	)
+}
+
+// endInvokeSpan ends the server span of an invocation with the status of the response.
+// Only server errors mark the span as failed, client errors are the caller's doing.
+func endInvokeSpan(span trace.Span, resp Response) {
+	code := resp.StatusCode()
+	span.SetAttributes(
+		attribute.Int("http.response.status_code", code),
+		attribute.Int("fn.error_count", len(resp.Errors)),
+	)
+	if code >= http.StatusInternalServerError {
+		msg := http.StatusText(code)
+		if len(resp.Errors) > 0 {
+			msg = resp.Errors[0].Message
+		}
+		span.SetStatus(codes.Error, msg)
+	}
+	span.End()
+}
+
+// TracingTransport wraps the transport of outbound HTTP calls, i.e. those to the Falcon
+// API, creating a client span for each request and propagating the trace context of the
+// request to the callee via the W3C traceparent header. The span ends once the response
+// headers are received. A nil base uses the http.DefaultTransport.
+func TracingTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &tracingTransport{base: base}
+}
+
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := startSpan(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Hostname()),
+			attribute.String("url.path", req.URL.Path),
+		),
+	)
+
+	// a RoundTripper must not modify the provided request
+	req = req.Clone(ctx)
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	span.End()
+
+	return resp, nil
+}